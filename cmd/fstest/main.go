@@ -4,36 +4,24 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"time"
 
 	"github.com/KaiqueGovani/venom/internal/api"
-	"github.com/KaiqueGovani/venom/internal/db"
+	"github.com/KaiqueGovani/venom/internal/config"
 	"github.com/KaiqueGovani/venom/internal/fs"
 	"github.com/KaiqueGovani/venom/internal/model"
-	"github.com/couchbase/gocb/v2"
-)
-
-const (
-	bucketName     = "venom"
-	scopeName      = "mindsnap"
-	collectionName = "projects"
 )
 
 func main() {
-	cluster, err := db.Connect()
+	cfg, err := config.Load(config.Config{})
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer cluster.Close(&gocb.ClusterCloseOptions{})
-
-	// Get the bucket
-	bucket := cluster.Bucket(bucketName)
-	bucket.WaitUntilReady(5*time.Second, nil)
 
-	// Get the collection
-	col := cluster.Bucket(bucketName).Scope(scopeName).Collection(collectionName)
-
-	a := api.NewApiHandler(bucketName, scopeName, collectionName, cluster, col)
+	a, err := api.Open(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer a.Close()
 
 	// Get all projects
 	projects, _ := a.GetProjects()
@@ -46,7 +34,11 @@ func main() {
 	fmt.Println(string(projectsJSON))
 
 	// Create the file system manager
-	fs := fs.New()
+	options, err := fs.OptionsFrom(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fs := fs.New(options)
 
 	// Get each project from the projects map into a slice
 	var projectValues []model.Project
@@ -1,58 +1,104 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
-	"time"
+	"text/tabwriter"
 
 	"github.com/KaiqueGovani/venom/internal/api"
 	"github.com/KaiqueGovani/venom/internal/app"
-	"github.com/KaiqueGovani/venom/internal/db"
+	"github.com/KaiqueGovani/venom/internal/backup"
+	"github.com/KaiqueGovani/venom/internal/config"
 	"github.com/KaiqueGovani/venom/internal/fs"
+	"github.com/KaiqueGovani/venom/internal/migrate"
 	"github.com/KaiqueGovani/venom/internal/model"
-	"github.com/couchbase/gocb/v2"
+	"github.com/KaiqueGovani/venom/internal/secret"
+	"github.com/KaiqueGovani/venom/internal/validation"
 )
 
-const (
-	bucketName     = "venom"
-	scopeName      = "mindsnap"
-	collectionName = "projects"
-)
-
-var a *api.ApiHandler
+var a api.API
 
 // #region CLI
 func main() {
-	if len(os.Args) < 2 {
+	overrides, args := parseGlobalFlags()
+	if len(args) < 1 {
 		helpCmd()
 		return
 	}
 
-	mainCmd := os.Args[1]
+	cfg, err := config.Load(overrides)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mainCmd := args[0]
 	switch mainCmd {
 	case "app":
-		app.RunApp()
+		app.RunApp(cfg)
 	case "configure":
-		cluster, err := initializeDatabase()
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer cluster.Close(&gocb.ClusterCloseOptions{})
+		closeApi := initializeApi(cfg)
+		defer closeApi()
 
-		a = api.NewApiHandler(bucketName, scopeName, collectionName, cluster, getCollection(cluster))
-		configureCmd()
+		configureCmd(cfg, args[1:])
 	case "pull":
-		cluster, err := initializeDatabase()
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer cluster.Close(&gocb.ClusterCloseOptions{})
+		closeApi := initializeApi(cfg)
+		defer closeApi()
+
+		pullCmd(cfg, args[1:])
+	case "history":
+		closeApi := initializeApi(cfg)
+		defer closeApi()
 
-		a = api.NewApiHandler(bucketName, scopeName, collectionName, cluster, getCollection(cluster))
-		pullCmd()
+		historyCmd(args[1:])
+	case "rollback":
+		closeApi := initializeApi(cfg)
+		defer closeApi()
+
+		rollbackCmd(args[1:])
+	case "trash":
+		closeApi := initializeApi(cfg)
+		defer closeApi()
+
+		trashCmd(args[1:])
+	case "backup":
+		closeApi := initializeApi(cfg)
+		defer closeApi()
+
+		backupCmd(cfg, args[1:])
+	case "restore":
+		closeApi := initializeApi(cfg)
+		defer closeApi()
+
+		restoreCmd(args[1:])
+	case "migrate":
+		migrateCmd(args[1:])
+	case "sync":
+		closeApi := initializeApi(cfg)
+		defer closeApi()
+
+		syncCmd(args[1:])
+	case "validate":
+		closeApi := initializeApi(cfg)
+		defer closeApi()
+
+		validateCmd(args[1:])
+	case "encrypt":
+		closeApi := initializeApi(cfg)
+		defer closeApi()
+
+		encryptCmd()
+	case "migrate-schema":
+		closeApi := initializeApi(cfg)
+		defer closeApi()
+
+		migrateSchemaCmd()
 	case "help":
 		helpCmd()
 	default:
@@ -60,32 +106,62 @@ func main() {
 	}
 }
 
-// initializeDatabase sets up the database connection and returns the cluster.
-func initializeDatabase() (*gocb.Cluster, error) {
-	cluster, err := db.Connect()
-	if err != nil {
-		return nil, err
+// parseGlobalFlags parses the flags given before the command and returns them with the remaining arguments.
+func parseGlobalFlags() (config.Config, []string) {
+	var overrides config.Config
+
+	globalSet := flag.NewFlagSet("venom", flag.ExitOnError)
+	globalSet.Usage = helpCmd
+	globalSet.StringVar(&overrides.Profile, "profile", "", "Config profile to use")
+	globalSet.StringVar(&overrides.Backend, "backend", "", "Backend to use")
+	globalSet.StringVar(&overrides.Bucket, "bucket", "", "Couchbase bucket")
+	globalSet.StringVar(&overrides.Scope, "scope", "", "Couchbase scope")
+	globalSet.StringVar(&overrides.Collection, "collection", "", "Couchbase collection")
+
+	if err := globalSet.Parse(os.Args[1:]); err != nil {
+		log.Fatal(err)
 	}
-	return cluster, nil
+
+	return overrides, globalSet.Args()
 }
 
-// getCollection retrieves the collection from the specified bucket.
-func getCollection(cluster *gocb.Cluster) *gocb.Collection {
-	bucket := cluster.Bucket(bucketName)
-	bucket.WaitUntilReady(5*time.Second, nil)
-	return bucket.Scope(scopeName).Collection(collectionName)
+// initializeApi opens the configured backend and returns a function that releases it.
+func initializeApi(cfg config.Config) func() {
+	var err error
+	a, err = api.Open(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cached, ok := api.AsCached(a); ok {
+		if cached.Offline() {
+			fmt.Fprintf(os.Stderr, "Server unreachable: using projects cached at %s. Edits are queued until 'venom sync'.\n",
+				cached.SyncedAt().Local().Format("2006-01-02 15:04:05"))
+		} else if pending := len(cached.Pending()); pending > 0 {
+			fmt.Fprintf(os.Stderr, "%d offline changes are waiting; run 'venom sync' to send them.\n", pending)
+		}
+	}
+
+	return func() {
+		a.Close()
+	}
 }
 
 // configureCmd handles the configuration commands.
-func configureCmd() {
+func configureCmd(cfg config.Config, args []string) {
 	configureSet := flag.NewFlagSet("configure", flag.ExitOnError)
 	defineFlags(configureSet)
 
-	if err := configureSet.Parse(os.Args[2:]); err != nil {
+	if err := configureSet.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	policy, err := secret.ParsePolicy(cfg.SecretPatterns)
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	executeConfigureCommand(configureSet)
+	executeConfigureCommand(configureSet, policy)
 }
 
 // defineFlags defines the flags used in the configure command.
@@ -94,53 +170,188 @@ func defineFlags(set *flag.FlagSet) {
 	set.Bool("add", false, "Add a new configuration")
 	set.String("name", "", "Name of the project to add or modify")
 	set.String("set", "", "Set a variable in the format KEY=VALUE")
+	set.Bool("secret", false, "Flag the variable given to --set as secret, or not with --secret=false")
 	set.String("unset", "", "Remove a specified key")
 	set.String("filename", "", "Filename associated with the project")
 	set.String("target", "", "Target folder path")
+	set.String("rename", "", "New name for the project")
+	set.String("file-mode", "", "Octal permissions of the project's env file, such as 0640")
+	set.String("env", "", "Environment to change with --set, --unset, --filename and --target")
+	set.Bool("delete-env", false, "Delete the environment given to --env")
+	set.String("add-target", "", "Add or replace an extra env file written on pull, relative to the pull root")
+	set.String("format", "", "Format of the target given to --add-target")
+	set.String("keys", "", "Comma-separated variables written to the target given to --add-target")
+	set.String("map", "", "Comma-separated OLD=NEW renames applied to the target given to --add-target")
+	set.String("remove-target", "", "Remove the extra env file with this path")
+	set.String("meta", "", "Variable whose --description, --owner, --default and --required to change")
+	set.String("description", "", "What the variable given to --meta is for")
+	set.String("owner", "", "Who owns the variable given to --meta")
+	set.String("default", "", "Value written on pull while the variable given to --meta is not set")
+	set.Bool("required", false, "Refuse to pull while the variable given to --meta has no value, or not with --required=false")
+	set.String("rule", "", "Variable whose values must satisfy the rule given by --type, --min, --max, --values and --pattern")
+	set.String("type", "", "Type of the rule given to --rule: "+strings.Join(validation.Types, ", "))
+	set.String("min", "", "Smallest int, or shortest string, accepted by the rule given to --rule")
+	set.String("max", "", "Largest int, or longest string, accepted by the rule given to --rule")
+	set.String("values", "", "Comma-separated values accepted by the enum rule given to --rule")
+	set.String("pattern", "", "Regular expression values of the regex rule given to --rule must match in full")
+	set.String("remove-rule", "", "Remove the rule of a variable")
+	set.String("parents", "", "Comma-separated projects whose variables this one inherits, later ones overriding earlier ones")
+	set.Bool("clear-parents", false, "Stop inheriting variables from other projects")
 }
 
 // executeConfigureCommand executes the logic for the configure command based on the flags.
-func executeConfigureCommand(set *flag.FlagSet) {
+func executeConfigureCommand(set *flag.FlagSet, policy secret.Policy) {
 	name := set.Lookup("name").Value.String()
+	env := set.Lookup("env").Value.String()
 	if set.Lookup("list").Value.String() == "true" {
-		listProjects()
+		listProjects(policy)
 	} else if set.Lookup("add").Value.String() == "true" {
 		addProject(name)
 	} else if set.Lookup("set").Value.String() != "" {
-		setProjectVariable(name, set.Lookup("set").Value.String())
+		setProjectVariable(name, env, set.Lookup("set").Value.String(), secretFlag(set), policy)
 	} else if set.Lookup("unset").Value.String() != "" {
-		unsetProjectVariable(name, set.Lookup("unset").Value.String())
+		unsetProjectVariable(name, env, set.Lookup("unset").Value.String())
+	} else if set.Lookup("delete-env").Value.String() == "true" {
+		deleteEnvironment(name, env)
+	} else if set.Lookup("meta").Value.String() != "" {
+		updateMeta(name, env, set.Lookup("meta").Value.String(), set)
+	} else if set.Lookup("rule").Value.String() != "" {
+		setRule(name, set.Lookup("rule").Value.String(), set)
+	} else if set.Lookup("remove-rule").Value.String() != "" {
+		removeRule(name, set.Lookup("remove-rule").Value.String())
+	} else if set.Lookup("parents").Value.String() != "" {
+		setParents(name, strings.Split(set.Lookup("parents").Value.String(), ","))
+	} else if set.Lookup("clear-parents").Value.String() == "true" {
+		setParents(name, nil)
+	} else if set.Lookup("add-target").Value.String() != "" {
+		addTarget(name, set.Lookup("add-target").Value.String(), set.Lookup("format").Value.String(),
+			set.Lookup("keys").Value.String(), set.Lookup("map").Value.String())
+	} else if set.Lookup("remove-target").Value.String() != "" {
+		removeTarget(name, set.Lookup("remove-target").Value.String())
+	} else if set.Lookup("file-mode").Value.String() != "" {
+		setFileMode(name, set.Lookup("file-mode").Value.String())
+	} else if set.Lookup("rename").Value.String() != "" {
+		renameProject(name, set.Lookup("rename").Value.String())
 	} else if set.Lookup("filename").Value.String() != "" && set.Lookup("target").Value.String() != "" {
-		editProject(name, set.Lookup("filename").Value.String(), set.Lookup("target").Value.String())
+		editProject(name, env, set.Lookup("filename").Value.String(), set.Lookup("target").Value.String())
 	} else {
 		fmt.Println("No valid command provided for 'configure'.")
 	}
 }
 
+// secretFlag returns the value of --secret, or nil when it was not given.
+func secretFlag(set *flag.FlagSet) *bool {
+	var flagged *bool
+	set.Visit(func(f *flag.Flag) {
+		if f.Name == "secret" {
+			value := f.Value.String() == "true"
+			flagged = &value
+		}
+	})
+	return flagged
+}
+
 // listProjects lists all projects.
-func listProjects() {
-	projects, err := a.GetProjects()
-	handleError(err)
+func listProjects(policy secret.Policy) {
+	projects := getProjects()
 
 	fmt.Print("\nProjects:\n\n")
 
+	lookup := lookupIn(projects)
 	for _, project := range projects {
 		fmt.Printf("Project Name: %s\n", project.Name)
 		fmt.Printf("  File: %s\n", project.FileName)
 		fmt.Printf("  Target Folder: %s\n", project.TargetFolder)
-		fmt.Printf("  Variables (%d):\n", len(project.Variables))
+		if len(project.Parents) > 0 {
+			fmt.Printf("  Parents: %s\n", strings.Join(project.Parents, ", "))
+		}
+		for _, target := range project.Targets {
+			fmt.Printf("  Target: %s\n", describeTarget(target))
+		}
+		printVariables("  ", project, model.DefaultEnvironment, lookup, policy)
+		printSchema(project)
 
-		for key, value := range project.Variables {
-			// Mask sensitive data with a placeholder
-			if strings.Contains(key, "SECRET") || strings.Contains(key, "KEY") {
-				value = "*****"
-			}
-			fmt.Printf("    - %s: %s\n", key, value)
+		for _, env := range project.EnvironmentNames() {
+			view := project.InEnvironment(env)
+			fmt.Printf("  Environment %s (file: %s, target folder: %s):\n", env, view.FileName, view.TargetFolder)
+			printVariables("    ", project, env, lookup, policy)
 		}
 		fmt.Println()
 	}
 }
 
+// printVariables lists the variables of an environment of a project, including the ones it
+// inherits, with their metadata. Variables that are only declared by their metadata are
+// listed as not set.
+func printVariables(indent string, project model.Project, env string, lookup func(string) (model.Project, error), policy secret.Policy) {
+	project, inheritance, err := project.Inherited(env, lookup)
+	if err != nil {
+		fmt.Printf("%sWarning: %v; listing only the project's own variables\n", indent, err)
+	}
+
+	fmt.Printf("%sVariables (%d):\n", indent, len(project.Variables))
+	for _, key := range project.VariableNames() {
+		value, ok := project.Variables[key]
+		if ok {
+			value = policy.Mask(project, key, value)
+		} else {
+			value = "(not set)"
+		}
+		if from, ok := inheritance.From[key]; ok {
+			value += fmt.Sprintf(" (from %s)", from)
+		} else if from, ok := inheritance.Overrides[key]; ok {
+			value += fmt.Sprintf(" (overrides %s)", from)
+		}
+		fmt.Printf("%s  - %s: %s\n", indent, key, value)
+
+		meta := project.Meta[key]
+		details := indent + "      "
+		if meta.Description != "" {
+			fmt.Printf("%s%s\n", details, meta.Description)
+		}
+		if meta.Owner != "" {
+			fmt.Printf("%sowner: %s\n", details, meta.Owner)
+		}
+		if meta.Default != "" {
+			fmt.Printf("%sdefault: %s\n", details, policy.Mask(project, key, meta.Default))
+		}
+		if meta.Required {
+			fmt.Printf("%srequired\n", details)
+		}
+		if meta.Modified != nil {
+			fmt.Printf("%smodified: %s\n", details, meta.Modified.Local().Format("2006-01-02 15:04"))
+		}
+	}
+}
+
+// printSchema lists the validation rules of a project.
+func printSchema(project model.Project) {
+	if len(project.Schema) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(project.Schema))
+	for key := range project.Schema {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("  Schema (%d):\n", len(keys))
+	for _, key := range keys {
+		fmt.Printf("    - %s: %s\n", key, validation.Describe(project.Schema[key]))
+	}
+}
+
+// lookupIn reads parent projects from projects that are already loaded.
+func lookupIn(projects map[string]model.Project) func(name string) (model.Project, error) {
+	return func(name string) (model.Project, error) {
+		project, ok := projects[name]
+		if !ok {
+			return project, fmt.Errorf("%w: %s", api.ErrProjectNotFound, name)
+		}
+		return project, nil
+	}
+}
+
 // addProject adds a new project.
 func addProject(name string) {
 	newProject := model.Project{
@@ -156,86 +367,399 @@ func addProject(name string) {
 	fmt.Printf("Added project with name: %s\n", name)
 }
 
-// setProjectVariable sets a variable for a project.
-func setProjectVariable(name, set string) {
-	project, err := a.GetProject(name)
-	handleError(err)
-
+// setProjectVariable sets a variable for a project, and its secret flag when one is given.
+func setProjectVariable(name, env, set string, flagged *bool, policy secret.Policy) {
 	key, value, found := strings.Cut(set, "=")
 	if !found {
 		log.Fatalf("Invalid set format: %s", set)
 	}
 
-	project.Variables[key] = value
-	_, err = a.UpdateProject(name, project)
+	project, err := a.GetProject(name)
+	handleError(err)
+	// A deleted or renamed parent must not lock the project, so fall back to its own rules
+	view, _, err := project.Inherited(env, a.GetProject)
+	if err != nil {
+		fmt.Printf("Warning: %v; checking %s against the project's own rules only\n", err, key)
+	}
+	if err := validation.Variable(view, key, value); err != nil {
+		log.Fatalf("Refusing to set %s in project %s: %v", key, name, err)
+	}
+
+	if flagged != nil {
+		err = api.SetSecretVariable(a, name, env, key, value, *flagged)
+	} else {
+		err = api.SetVariableIn(a, name, env, key, value)
+	}
 	handleError(err)
 
-	fmt.Printf("Set %s = %s for project %s\n", key, value, project.Name)
+	project, err = a.GetProject(name)
+	handleError(err)
+	// An unresolved parent was reported above; its own view is enough to mask the value
+	view, _, _ = project.Inherited(env, a.GetProject)
+	fmt.Printf("Set %s = %s for project %s%s\n", key, policy.Mask(view, key, value), name, inEnvironment(env))
 }
 
 // unsetProjectVariable removes a variable from a project.
-func unsetProjectVariable(name, unset string) {
+func unsetProjectVariable(name, env, unset string) {
+	err := api.UnsetVariableIn(a, name, env, unset)
+	if errors.Is(err, api.ErrVariableNotFound) {
+		log.Fatalf("Key %s not found in project %s%s", unset, name, inEnvironment(env))
+	}
+	handleError(err)
+
+	fmt.Printf("Removed key %s from project %s%s\n", unset, name, inEnvironment(env))
+}
+
+// deleteEnvironment removes a named environment and its variables from a project.
+func deleteEnvironment(name, env string) {
+	if env == model.DefaultEnvironment {
+		log.Fatal("The --delete-env flag requires --env.")
+	}
+	project, err := a.GetProject(name)
+	handleError(err)
+	if !project.HasEnvironment(env) {
+		log.Fatalf("%v: %s in project %s", api.ErrEnvironmentNotFound, env, name)
+	}
+
+	delete(project.Environments, env)
+	_, err = a.UpdateProject(name, project)
+	handleError(err)
+
+	fmt.Printf("Deleted environment %s from project %s\n", env, name)
+}
+
+// updateMeta changes the metadata of a variable given by the --description, --owner, --default
+// and --required flags. Flags that are not given are left alone, and an empty value clears one.
+func updateMeta(name, env, key string, set *flag.FlagSet) {
+	var given []string
+	set.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "description", "owner", "default", "required":
+			given = append(given, f.Name)
+		}
+	})
+	if len(given) == 0 {
+		log.Fatal("The --meta flag requires at least one of --description, --owner, --default and --required.")
+	}
+
+	err := api.UpdateVariableMeta(a, name, env, key, func(meta *model.VariableMeta) {
+		for _, flagName := range given {
+			value := set.Lookup(flagName).Value.String()
+			switch flagName {
+			case "description":
+				meta.Description = value
+			case "owner":
+				meta.Owner = value
+			case "default":
+				meta.Default = value
+			case "required":
+				meta.Required = value == "true"
+			}
+		}
+	})
+	handleError(err)
+
+	fmt.Printf("Updated %s of %s in project %s%s\n", strings.Join(given, ", "), key, name, inEnvironment(env))
+}
+
+// setRule sets the validation rule of a variable from the --type, --min, --max, --values and
+// --pattern flags, then warns about current values the rule rejects.
+func setRule(name, key string, set *flag.FlagSet) {
+	rule := model.Rule{
+		Type:    set.Lookup("type").Value.String(),
+		Pattern: set.Lookup("pattern").Value.String(),
+	}
+	if values := set.Lookup("values").Value.String(); values != "" {
+		for _, value := range strings.Split(values, ",") {
+			rule.Values = append(rule.Values, strings.TrimSpace(value))
+		}
+	}
+	rule.Min = parseBound(set, "min")
+	rule.Max = parseBound(set, "max")
+	if err := validation.CheckRule(rule); err != nil {
+		log.Fatal(err)
+	}
+
+	err := api.SetRule(a, name, key, &rule)
+	handleError(err)
+	fmt.Printf("Set rule %s: %s for project %s\n", key, validation.Describe(rule), name)
+
+	project, err := a.GetProject(name)
+	handleError(err)
+	for _, problem := range validation.Project(project) {
+		if problem.Key == key && !errors.Is(problem.Err, validation.ErrRequired) {
+			fmt.Printf("Warning: %v\n", problem)
+		}
+	}
+}
+
+// parseBound returns the integer given to a --min or --max flag, or nil when it is empty.
+func parseBound(set *flag.FlagSet, flagName string) *int64 {
+	value := set.Lookup(flagName).Value.String()
+	if value == "" {
+		return nil
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid --%s value: %s", flagName, value)
+	}
+	return &number
+}
+
+// setParents sets the projects a project inherits variables from, or clears them.
+func setParents(name string, parents []string) {
+	for i := range parents {
+		parents[i] = strings.TrimSpace(parents[i])
+	}
+	err := api.SetParents(a, name, parents)
+	handleError(err)
+
+	if len(parents) == 0 {
+		fmt.Printf("Project %s no longer inherits variables\n", name)
+		return
+	}
+	fmt.Printf("Project %s now inherits variables from %s\n", name, strings.Join(parents, ", "))
+}
+
+// removeRule removes the validation rule of a variable.
+func removeRule(name, key string) {
+	err := api.SetRule(a, name, key, nil)
+	handleError(err)
+
+	fmt.Printf("Removed rule %s from project %s\n", key, name)
+}
+
+// addTarget adds an extra env file to a project, replacing any target with the same path.
+func addTarget(name, path, format, keys, renames string) {
+	target := model.Target{Path: path, Format: format}
+	if keys != "" {
+		for _, key := range strings.Split(keys, ",") {
+			target.Keys = append(target.Keys, strings.TrimSpace(key))
+		}
+	}
+	if renames != "" {
+		target.Rename = make(map[string]string)
+		for _, rename := range strings.Split(renames, ",") {
+			from, to, found := strings.Cut(rename, "=")
+			if !found {
+				log.Fatalf("Invalid map format: %s", rename)
+			}
+			target.Rename[strings.TrimSpace(from)] = strings.TrimSpace(to)
+		}
+	}
+	if err := fs.ValidateTarget(target); err != nil {
+		log.Fatal(err)
+	}
+
+	project, err := a.GetProject(name)
+	handleError(err)
+
+	replaced := false
+	for i, existing := range project.Targets {
+		if existing.Path == target.Path {
+			project.Targets[i] = target
+			replaced = true
+		}
+	}
+	if !replaced {
+		project.Targets = append(project.Targets, target)
+	}
+
+	_, err = a.UpdateProject(name, project)
+	handleError(err)
+
+	fmt.Printf("Project %s now writes %s\n", name, describeTarget(target))
+}
+
+// removeTarget removes an extra env file from a project.
+func removeTarget(name, path string) {
 	project, err := a.GetProject(name)
 	handleError(err)
 
-	if _, ok := project.Variables[unset]; !ok {
-		log.Fatalf("Key %s not found in project %s", unset, project.Name)
+	targets := project.Targets[:0]
+	for _, target := range project.Targets {
+		if target.Path != path {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == len(project.Targets) {
+		log.Fatalf("Target %s not found in project %s", path, name)
 	}
+	project.Targets = targets
 
-	delete(project.Variables, unset)
 	_, err = a.UpdateProject(name, project)
 	handleError(err)
 
-	fmt.Printf("Removed key %s from project %s\n", unset, project.Name)
+	fmt.Printf("Removed target %s from project %s\n", path, name)
+}
+
+// describeTarget summarizes a target for listings.
+func describeTarget(target model.Target) string {
+	description := target.Path
+	if target.Format != "" {
+		description += " as " + target.Format
+	}
+	if len(target.Keys) > 0 {
+		description += ", keys " + strings.Join(target.Keys, ", ")
+	}
+	if len(target.Rename) > 0 {
+		var renames []string
+		for from, to := range target.Rename {
+			renames = append(renames, from+" → "+to)
+		}
+		sort.Strings(renames)
+		description += ", renaming " + strings.Join(renames, ", ")
+	}
+	return description
+}
+
+// inEnvironment describes an environment for messages about a project.
+func inEnvironment(env string) string {
+	if env == model.DefaultEnvironment {
+		return ""
+	}
+	return fmt.Sprintf(" (environment %s)", env)
+}
+
+// renameProject renames a project, keeping its variables and history.
+func renameProject(name, newName string) {
+	if name == "" {
+		log.Fatal("The --rename flag requires --name.")
+	}
+	project, err := a.RenameProject(name, newName)
+	handleError(err)
+
+	fmt.Printf("Renamed project %s to %s\n", name, project.Name)
+
+	// Children refer to their parents by name, so they lose what they inherited
+	projects := getProjects()
+	var children []string
+	for _, child := range projects {
+		if slices.Contains(child.Parents, name) {
+			children = append(children, child.Name)
+		}
+	}
+	if len(children) > 0 {
+		sort.Strings(children)
+		fmt.Printf("Warning: projects still inheriting from %s: %s. Update them with --parents.\n", name, strings.Join(children, ", "))
+	}
 }
 
 // editProject edits the project details.
-func editProject(name, filename, target string) {
+func editProject(name, env, filename, target string) {
 	project, err := a.GetProject(name)
 	handleError(err)
 
-	project.FileName = filename
-	project.TargetFolder = target
+	if !project.HasEnvironment(env) {
+		if err := model.ValidateEnvironmentName(env); err != nil {
+			log.Fatal(err)
+		}
+	}
+	project.SetFileIn(env, filename, target)
+	if err := fs.ValidatePaths(project.InEnvironment(env)); err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = a.UpdateProject(name, project)
+	handleError(err)
+
+	fmt.Printf("Updated project %s%s with new file: %s and target: %s\n", project.Name, inEnvironment(env), filename, target)
+}
+
+// setFileMode sets the permissions pull gives the project's env file.
+func setFileMode(name, mode string) {
+	if _, err := fs.ParseFileMode(mode); err != nil {
+		log.Fatal(err)
+	}
+	project, err := a.GetProject(name)
+	handleError(err)
 
+	project.FileMode = mode
 	_, err = a.UpdateProject(name, project)
 	handleError(err)
 
-	fmt.Printf("Updated project %s with new file: %s and target: %s\n", project.Name, filename, target)
+	fmt.Printf("Updated project %s with file mode %s\n", name, mode)
 }
 
 // handleError checks for errors and logs appropriately.
 func handleError(err error) {
+	var conflict *api.ConflictError
+	if errors.As(err, &conflict) {
+		log.Fatalf("%v. Nothing was saved; run the command again to apply it to the latest version.", err)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// getProjects returns every project, leaving out with a warning those the configured key cannot decrypt.
+func getProjects() map[string]model.Project {
+	projects, err := a.GetProjects()
+	var unreadable *api.UnreadableError
+	if errors.As(err, &unreadable) {
+		log.Printf("Warning: skipping projects that cannot be decrypted: %v", err)
+		return projects
+	}
+	handleError(err)
+	return projects
+}
+
 // pullCmd retrieves project variables and saves them to the file system.
-func pullCmd() {
+func pullCmd(cfg config.Config, args []string) {
 	pullSet := flag.NewFlagSet("pull", flag.ExitOnError)
 	projectName := pullSet.String("name", "", "Specify project name to pull")
+	env := pullSet.String("env", "", "Environment to pull instead of the project's own variables")
+	root := pullSet.String("root", "", "Folder to write env files under, instead of the pull_root setting or the working directory")
 
-	if err := pullSet.Parse(os.Args[2:]); err != nil {
+	if err := pullSet.Parse(args); err != nil {
 		log.Fatal(err)
 	}
 
+	options, err := fs.OptionsFrom(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *root != "" {
+		options.Root = *root
+	}
+
 	if *projectName != "" {
 		// Pull only the specified project
 		project, err := a.GetProject(*projectName)
 		handleError(err)
+		if !project.HasEnvironment(*env) {
+			log.Fatalf("%v: %s in project %s", api.ErrEnvironmentNotFound, *env, project.Name)
+		}
+
+		view, _, err := project.Inherited(*env, a.GetProject)
+		handleError(err)
 
-		fs := fs.New()
-		err = fs.SaveVariables([]model.Project{project})
+		fs := fs.New(options)
+		err = fs.SaveVariables([]model.Project{view})
 		handleError(err)
 
 		log.Printf("Project %s saved successfully.\n", project.Name)
 	} else {
 		// Pull all projects
-		projects, err := a.GetProjects()
-		handleError(err)
+		projects := getProjects()
 
-		fs := fs.New()
-		projectValues := convertProjectsToSlice(projects)
+		fs := fs.New(options)
+		lookup := lookupIn(projects)
+		var projectValues []model.Project
+		for _, project := range convertProjectsToSlice(projects) {
+			if !project.HasEnvironment(*env) {
+				log.Printf("Skipping project %s, which has no %s environment.\n", project.Name, *env)
+				continue
+			}
+			if len(project.InEnvironment(*env).Outputs()) == 0 {
+				// Typically a base project that only exists to be inherited from
+				log.Printf("Skipping project %s, which has no file name or targets.\n", project.Name)
+				continue
+			}
+			view, _, err := project.Inherited(*env, lookup)
+			handleError(err)
+			projectValues = append(projectValues, view)
+		}
 
 		err = fs.SaveVariables(projectValues)
 		handleError(err)
@@ -244,6 +768,462 @@ func pullCmd() {
 	}
 }
 
+// validateCmd checks projects against their schema and required variables, exiting with an
+// error when any of them would fail to pull.
+func validateCmd(args []string) {
+	validateSet := flag.NewFlagSet("validate", flag.ExitOnError)
+	projectName := validateSet.String("name", "", "Specify project name to validate")
+	env := validateSet.String("env", "", "Only validate this environment")
+	if err := validateSet.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	envGiven := false
+	validateSet.Visit(func(f *flag.Flag) {
+		envGiven = envGiven || f.Name == "env"
+	})
+
+	var projects []model.Project
+	lookup := a.GetProject
+	if *projectName != "" {
+		project, err := a.GetProject(*projectName)
+		handleError(err)
+		projects = append(projects, project)
+	} else {
+		all := getProjects()
+		projects = convertProjectsToSlice(all)
+		sort.Slice(projects, func(i, j int) bool { return projects[i].Name < projects[j].Name })
+		lookup = lookupIn(all)
+	}
+
+	failed := 0
+	for _, project := range projects {
+		environments := append([]string{model.DefaultEnvironment}, project.EnvironmentNames()...)
+		if envGiven {
+			if !project.HasEnvironment(*env) {
+				if *projectName != "" {
+					log.Fatalf("%v: %s in project %s", api.ErrEnvironmentNotFound, *env, project.Name)
+				}
+				continue
+			}
+			environments = []string{*env}
+		}
+
+		// Variables are checked with the ones they inherit, as pull would write them
+		var problems []error
+		for _, environment := range environments {
+			view, _, err := project.Inherited(environment, lookup)
+			if err != nil {
+				// A missing parent or a cycle breaks every environment alike
+				problems = append(problems, err)
+				break
+			}
+			for _, problem := range validation.Environment(view, environment) {
+				problems = append(problems, problem)
+			}
+		}
+
+		if len(problems) == 0 {
+			fmt.Printf("Project %s: ok\n", project.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("Project %s:\n", project.Name)
+		for _, problem := range problems {
+			fmt.Printf("  - %v\n", problem)
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d projects failed validation", failed, len(projects))
+	}
+}
+
+// historyCmd lists the revisions recorded for a project.
+func historyCmd(args []string) {
+	historySet := flag.NewFlagSet("history", flag.ExitOnError)
+	projectName := historySet.String("name", "", "Project to list revisions for")
+
+	if err := historySet.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if *projectName == "" {
+		log.Fatal("The history command requires --name.")
+	}
+
+	history, err := a.GetHistory(*projectName)
+	handleError(err)
+
+	if len(history) == 0 {
+		fmt.Printf("No revisions recorded for project %s\n", *projectName)
+		return
+	}
+
+	fmt.Printf("\nRevisions of %s:\n\n", *projectName)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  #\tWhen\tWho\tAction\tDetail\tVariables")
+	for _, revision := range history {
+		fmt.Fprintf(w, "  %d\t%s\t%s\t%s\t%s\t%d\n",
+			revision.Number,
+			revision.Timestamp.Local().Format("2006-01-02 15:04:05"),
+			revision.Author,
+			revision.Action,
+			revision.Detail,
+			len(revision.Snapshot.Variables),
+		)
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// rollbackCmd restores a project to the state stored in one of its revisions.
+func rollbackCmd(args []string) {
+	rollbackSet := flag.NewFlagSet("rollback", flag.ExitOnError)
+	projectName := rollbackSet.String("name", "", "Project to roll back")
+	to := rollbackSet.Int("to", 0, "Revision number to restore")
+
+	if err := rollbackSet.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if *projectName == "" || *to <= 0 {
+		log.Fatal("The rollback command requires --name and --to.")
+	}
+
+	project, err := a.Rollback(*projectName, *to)
+	handleError(err)
+
+	fmt.Printf("Rolled back project %s to revision %d (%d variables)\n", project.Name, *to, len(project.Variables))
+}
+
+// trashCmd lists, restores and purges deleted projects.
+func trashCmd(args []string) {
+	if len(args) < 1 {
+		log.Fatal("The trash command requires a subcommand: list, restore NAME or purge [NAME].")
+	}
+
+	switch args[0] {
+	case "list":
+		listTrash()
+	case "restore":
+		if len(args) != 2 {
+			log.Fatal("The trash restore command requires a project name.")
+		}
+		project, err := a.RestoreProject(args[1])
+		handleError(err)
+		fmt.Printf("Restored project %s (%d variables)\n", project.Name, len(project.Variables))
+	case "purge":
+		if len(args) > 2 {
+			log.Fatal("The trash purge command accepts at most one project name.")
+		}
+		projectName := ""
+		if len(args) == 2 {
+			projectName = args[1]
+		}
+		purged, err := a.PurgeTrash(projectName)
+		handleError(err)
+		if projectName != "" {
+			fmt.Printf("Permanently deleted project %s\n", projectName)
+		} else {
+			fmt.Printf("Permanently deleted %d projects from the trash\n", purged)
+		}
+	default:
+		log.Fatalf("Trash subcommand '%s' not recognized.\n", args[0])
+	}
+}
+
+// listTrash prints the deleted projects with who deleted them and when they expire.
+func listTrash() {
+	trash, err := a.ListTrash()
+	handleError(err)
+
+	if len(trash) == 0 {
+		fmt.Println("The trash is empty")
+		return
+	}
+
+	fmt.Print("\nTrash:\n\n")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  Project\tDeleted\tBy\tExpires\tVariables")
+	for _, trashed := range trash {
+		expires := "never"
+		if !trashed.ExpiresAt.IsZero() {
+			expires = trashed.ExpiresAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%d\n",
+			trashed.Project.Name,
+			trashed.DeletedAt.Local().Format("2006-01-02 15:04:05"),
+			trashed.DeletedBy,
+			expires,
+			len(trashed.Project.Variables),
+		)
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// backupCmd saves every project to a versioned archive.
+func backupCmd(cfg config.Config, args []string) {
+	backupSet := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := backupSet.String("out", "", "File to write the backup to")
+	compress := backupSet.Bool("gzip", false, "Compress the backup (implied by a .gz file name)")
+
+	if err := backupSet.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if *out == "" {
+		log.Fatal("The backup command requires --out.")
+	}
+
+	// Encrypted projects are archived as stored, so the backup never holds their secrets in clear
+	archive, err := backup.Create(api.Stored(a), cfg)
+	handleError(err)
+
+	err = backup.WriteFile(*out, archive, *compress || strings.HasSuffix(*out, ".gz"))
+	handleError(err)
+
+	fmt.Printf("Backed up %d projects to %s\n", len(archive.Entries), *out)
+}
+
+// restoreCmd writes the projects of a backup archive to the active backend.
+func restoreCmd(args []string) {
+	restoreSet := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := restoreSet.String("in", "", "Backup file to restore")
+	modeFlag := restoreSet.String("mode", string(backup.SkipExisting), "What to do with existing projects: skip-existing or overwrite")
+	dryRun := restoreSet.Bool("dry-run", false, "Report what would be restored without writing anything")
+
+	if err := restoreSet.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if *in == "" {
+		log.Fatal("The restore command requires --in.")
+	}
+	mode, err := backup.ParseMode(*modeFlag)
+	handleError(err)
+
+	archive, err := backup.ReadFile(*in)
+	handleError(err)
+
+	fmt.Printf("\nBackup of %d projects from %s taken %s by %s\n\n",
+		len(archive.Entries), archive.Source.Backend, archive.CreatedAt.Local().Format("2006-01-02 15:04:05"), archive.CreatedBy)
+
+	// Archived projects are written back as stored, encrypted values included, so they must be
+	// readable with the configured key
+	if encrypted, ok := a.(*api.EncryptedHandler); ok {
+		for _, entry := range archive.Entries {
+			if err := encrypted.CheckKey(entry.Project); err != nil {
+				log.Fatalf("Refusing to restore: project %s in the backup cannot be read with the configured key: %v", entry.ID, err)
+			}
+		}
+	}
+	results, err := backup.Restore(api.Stored(a), archive, mode, *dryRun)
+	handleError(err)
+
+	counts := map[string]int{}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		counts[result.Outcome]++
+		if result.Err != nil {
+			fmt.Fprintf(w, "  %s\t%s\t%v\n", result.ID, result.Outcome, result.Err)
+		} else {
+			fmt.Fprintf(w, "  %s\t%s\n", result.ID, result.Outcome)
+		}
+	}
+	w.Flush()
+
+	prefix := ""
+	if *dryRun {
+		prefix = "Dry run: "
+	}
+	fmt.Printf("\n%s%d created, %d overwritten, %d skipped, %d failed\n", prefix,
+		counts[backup.Created], counts[backup.Overwritten], counts[backup.Skipped], counts[backup.Failed])
+	if counts[backup.Failed] > 0 {
+		os.Exit(1)
+	}
+}
+
+// migrateCmd copies projects between two profiles, resuming from a checkpoint.
+func migrateCmd(args []string) {
+	migrateSet := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := migrateSet.String("from", "", "Profile to copy projects from")
+	to := migrateSet.String("to", "", "Profile to copy projects to")
+	match := migrateSet.String("match", "", "Only migrate projects whose name matches this glob pattern")
+	overwrite := migrateSet.Bool("overwrite", false, "Replace projects that already exist on the target")
+	checkpointFile := migrateSet.String("checkpoint", "", "File tracking progress so a failed run can resume")
+	restart := migrateSet.Bool("restart", false, "Ignore progress saved by a previous run")
+
+	if err := migrateSet.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if *from == "" || *to == "" {
+		log.Fatal("The migrate command requires --from and --to.")
+	}
+	if *from == *to {
+		log.Fatal("The migrate command requires two different profiles.")
+	}
+
+	source, closeSource := openProfile(*from)
+	defer closeSource()
+	target, closeTarget := openProfile(*to)
+	defer closeTarget()
+
+	if *checkpointFile == "" {
+		var err error
+		*checkpointFile, err = migrate.CheckpointPath(*from, *to)
+		handleError(err)
+	}
+	if *restart {
+		if err := os.Remove(*checkpointFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Fatal(err)
+		}
+	}
+
+	results, err := migrate.Run(source, target, *from, *to, migrate.Options{
+		Match:      *match,
+		Overwrite:  *overwrite,
+		Checkpoint: *checkpointFile,
+	})
+
+	counts := map[string]int{}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		counts[result.Outcome]++
+		if result.Err != nil {
+			fmt.Fprintf(w, "  %s\t%s\t%v\n", result.ID, result.Outcome, result.Err)
+		} else {
+			fmt.Fprintf(w, "  %s\t%s\n", result.ID, result.Outcome)
+		}
+	}
+	w.Flush()
+	handleError(err)
+
+	fmt.Printf("\n%d copied, %d overwritten, %d already migrated, %d conflicts, %d failed\n",
+		counts[migrate.Copied], counts[migrate.Overwritten], counts[migrate.Resumed], counts[migrate.Conflict], counts[migrate.Failed])
+	if counts[migrate.Conflict] > 0 {
+		fmt.Println("Conflicting projects already exist on the target; re-run with --overwrite to replace them.")
+	}
+	if counts[migrate.Failed] > 0 {
+		fmt.Printf("Progress was saved to %s; run the same command again to retry the rest.\n", *checkpointFile)
+		os.Exit(1)
+	}
+}
+
+// encryptCmd rewrites every plaintext project so its values are encrypted with the configured key.
+func encryptCmd() {
+	encrypted, ok := a.(*api.EncryptedHandler)
+	if !ok || !encrypted.Encrypting() {
+		log.Fatal("No encryption key is configured. Set encryption_key_file or encryption_passphrase_env.")
+	}
+
+	projects := getProjects()
+
+	count := 0
+	for _, project := range convertProjectsToSlice(projects) {
+		if project.Encryption != nil {
+			continue
+		}
+		_, err := a.UpdateProject(project.Name, project)
+		handleError(err)
+		count++
+	}
+	fmt.Printf("Encrypted %d projects (%d already encrypted)\n", count, len(projects)-count)
+}
+
+// migrateSchemaCmd rewrites projects stored in an older document layout.
+func migrateSchemaCmd() {
+	migrated, err := a.MigrateSchema()
+	if migrated > 0 {
+		fmt.Printf("Upgraded %d projects to schema version %d\n", migrated, model.CurrentSchemaVersion)
+	}
+	handleError(err)
+
+	if migrated == 0 {
+		fmt.Printf("All projects already use schema version %d\n", model.CurrentSchemaVersion)
+	}
+}
+
+// syncCmd sends, lists or discards the edits queued while the server was unreachable.
+func syncCmd(args []string) {
+	syncSet := flag.NewFlagSet("sync", flag.ExitOnError)
+	status := syncSet.Bool("status", false, "List pending changes without sending them")
+	force := syncSet.Bool("force", false, "Apply conflicting changes over the server's version")
+	discard := syncSet.Bool("discard", false, "Drop every pending change")
+
+	if err := syncSet.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+
+	cached, ok := api.AsCached(a)
+	if !ok {
+		log.Fatal("The offline cache is not enabled for this backend.")
+	}
+
+	switch {
+	case *status:
+		pending := cached.Pending()
+		if len(pending) == 0 {
+			fmt.Println("No pending changes")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, change := range pending {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", change.QueuedAt.Local().Format("2006-01-02 15:04:05"), change.Project, describeChange(change))
+		}
+		w.Flush()
+	case *discard:
+		discarded, err := cached.Discard()
+		handleError(err)
+		fmt.Printf("Discarded %d pending changes\n", discarded)
+	default:
+		results, err := cached.Sync(*force)
+
+		counts := map[string]int{}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, result := range results {
+			counts[result.Outcome]++
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", result.Change.Project, describeChange(result.Change), result.Outcome)
+		}
+		w.Flush()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("\n%d applied, %d conflicts, %d blocked by a conflict\n", counts[api.SyncApplied], counts[api.SyncConflict], counts[api.SyncBlocked])
+		if counts[api.SyncConflict] > 0 {
+			fmt.Println("Conflicting changes were kept. Re-run with --force to overwrite the server, or --discard to drop them.")
+			os.Exit(1)
+		}
+	}
+}
+
+// describeChange summarizes a pending change for sync listings.
+func describeChange(change api.PendingChange) string {
+	switch change.Action {
+	case api.PendingSet:
+		return "set " + change.Key
+	case api.PendingUnset:
+		return "unset " + change.Key
+	}
+	return change.Action
+}
+
+// openProfile opens the backend configured by a profile, independent of the global flags.
+// The offline cache is left out, so an unreachable server fails instead of serving stale
+// projects or queueing writes.
+func openProfile(profile string) (api.API, func()) {
+	cfg, err := config.Load(config.Config{Profile: profile})
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.OfflineCache = "false"
+	handler, err := api.Open(cfg)
+	if err != nil {
+		log.Fatalf("profile %s: %v", profile, err)
+	}
+	return handler, func() {
+		handler.Close()
+	}
+}
+
 // helpCmd lists all available commands with brief descriptions.
 func helpCmd() {
 	fmt.Print("\nAvailable commands:\n\n")
@@ -254,19 +1234,100 @@ func helpCmd() {
 	fmt.Println("    --add            - Add a new project. Requires --name.")
 	fmt.Println("    --name           - Specify project name for adding or editing.")
 	fmt.Println("    --set KEY=VALUE  - Set a variable for the specified project.")
+	fmt.Println("    --secret         - With --set, flag the variable as secret so its value is masked. --secret=false unflags it.")
 	fmt.Println("    --unset KEY      - Remove a variable from the specified project.")
 	fmt.Println("    --filename       - Set the filename associated with the project.")
 	fmt.Println("    --target         - Set the target folder for the project.")
+	fmt.Println("    --rename NEW     - Rename the specified project, keeping its variables and history.")
+	fmt.Println("    --file-mode MODE - Set the octal permissions of the project's env file (default 0600).")
+	fmt.Println("    --env ENV        - Apply --set, --unset, --filename and --target to a named environment, creating it if needed.")
+	fmt.Println("    --delete-env     - Delete the environment given to --env.")
+	fmt.Println("    --meta KEY       - Document a variable, set or not. Options, each cleared by an empty value:")
+	fmt.Println("      --description TEXT - What the variable is for.")
+	fmt.Println("      --owner NAME       - Who to ask about it.")
+	fmt.Println("      --default VALUE    - Value written on pull while the variable is not set.")
+	fmt.Println("      --required         - Refuse to pull while the variable has no value. --required=false undoes it.")
+	fmt.Println("    --add-target PATH - Also write the variables to PATH on pull, replacing any target with that path. Options:")
+	fmt.Printf("      --format FORMAT  - %s (default dotenv).\n", strings.Join(fs.FormatNames(), ", "))
+	fmt.Println("      --keys A,B       - Only write these variables.")
+	fmt.Println("      --map OLD=NEW,.. - Write variables under other names.")
+	fmt.Println("    --remove-target PATH - Stop writing the target with this path.")
+	fmt.Println("    --rule KEY       - Validate the variable in every environment, on --set, in the app and before pull. Options:")
+	fmt.Printf("      --type TYPE      - %s.\n", strings.Join(validation.Types, ", "))
+	fmt.Println("      --min N, --max N - Range of an int, or length of a string.")
+	fmt.Println("      --values A,B     - Values accepted by an enum.")
+	fmt.Println("      --pattern REGEX  - Expression a regex value must match in full.")
+	fmt.Println("    --remove-rule KEY - Stop validating the variable.")
+	fmt.Println("    --parents A,B    - Inherit the variables, metadata and rules of these projects. The project overrides them, later ones override earlier ones.")
+	fmt.Println("    --clear-parents  - Stop inheriting from other projects.")
 	fmt.Println()
 	fmt.Println("  pull       - Retrieve project variables and save them to the file system.")
 	fmt.Println("    --name           - (Optional) Specify the project to pull. If omitted, pulls all projects.")
+	fmt.Println("    --env ENV        - (Optional) Pull a named environment. Projects without it are skipped.")
+	fmt.Println("    --root DIR       - (Optional) Folder to write env files under. Defaults to pull_root or the working directory.")
+	fmt.Println()
+	fmt.Println("  validate   - Check variables against their rules and required flags. Exits with an error on problems.")
+	fmt.Println("    --name           - (Optional) Specify the project to validate. If omitted, validates all projects.")
+	fmt.Println("    --env ENV        - (Optional) Only validate a named environment. Projects without it are skipped.")
+	fmt.Println()
+	fmt.Println("  history    - List the revisions recorded for a project.")
+	fmt.Println("    --name           - Specify the project.")
+	fmt.Println()
+	fmt.Println("  rollback   - Restore a project to a previous revision.")
+	fmt.Println("    --name           - Specify the project.")
+	fmt.Println("    --to N           - Revision number to restore, as listed by 'history'.")
+	fmt.Println()
+	fmt.Println("  trash      - Manage deleted projects. Subcommands:")
+	fmt.Println("    list             - List deleted projects and when they expire.")
+	fmt.Println("    restore NAME     - Move a deleted project back to the projects list.")
+	fmt.Println("    purge [NAME]     - Permanently delete a project, or empty the trash when NAME is omitted.")
+	fmt.Println()
+	fmt.Println("  backup     - Save every project to a versioned archive.")
+	fmt.Println("    --out FILE       - File to write. A .gz name compresses the archive.")
+	fmt.Println("    --gzip           - Compress the archive regardless of the file name.")
+	fmt.Println()
+	fmt.Println("  restore    - Restore projects from a backup archive.")
+	fmt.Println("    --in FILE        - Archive written by 'backup', compressed or not.")
+	fmt.Println("    --mode MODE      - skip-existing (default) keeps current projects; overwrite replaces them.")
+	fmt.Println("    --dry-run        - Report what would be restored without writing anything.")
+	fmt.Println()
+	fmt.Println("  migrate    - Copy projects between two profiles, keeping their names.")
+	fmt.Println("    --from PROFILE   - Profile to read projects from.")
+	fmt.Println("    --to PROFILE     - Profile to write projects to.")
+	fmt.Println("    --match PATTERN  - (Optional) Only migrate projects matching a glob such as 'api-*'.")
+	fmt.Println("    --overwrite      - Replace projects that already exist on the target instead of reporting a conflict.")
+	fmt.Println("    --checkpoint     - Progress file. Defaults to migrate-FROM-TO.json next to the config file.")
+	fmt.Println("    --restart        - Discard saved progress and start over.")
+	fmt.Println()
+	fmt.Println("  sync       - Send edits made while the server was unreachable.")
+	fmt.Println("    --status         - List pending changes without sending them.")
+	fmt.Println("    --force          - Apply conflicting changes over the server's version.")
+	fmt.Println("    --discard        - Drop every pending change.")
+	fmt.Println()
+	fmt.Println("  encrypt    - Encrypt the variables of every project not encrypted yet, using the configured key.")
+	fmt.Println()
+	fmt.Println("  migrate-schema - Rewrite projects stored in an older document layout to the current one.")
 	fmt.Println()
 	fmt.Println("  help       - List all available commands with brief descriptions.")
 	fmt.Println()
+	fmt.Println("Global flags (before the command):")
+	fmt.Println("  --profile        - Config profile to use. Defaults to VENOM_PROFILE or the file's 'profile' key.")
+	fmt.Printf("  --backend        - Backend to use (%s). Defaults to %s.\n", strings.Join(api.Backends(), ", "), config.Default().Backend)
+	fmt.Println("  --bucket         - Couchbase bucket holding the projects.")
+	fmt.Println("  --scope          - Couchbase scope holding the projects.")
+	fmt.Println("  --collection     - Couchbase collection holding the projects.")
+	fmt.Println()
+	fmt.Println("Settings are resolved from the config file (VENOM_CONFIG, defaults to <user config dir>/venom/config),")
+	fmt.Println("then the selected profile section, then VENOM_* environment variables, then global flags.")
+	fmt.Println()
 	fmt.Println("Example usage:")
 	fmt.Println("  venom app")
 	fmt.Println("  venom configure --add --name MyProject")
 	fmt.Println("  venom pull --name MyProject")
+	fmt.Println("  venom configure --name MyProject --rule PORT --type int --min 1 --max 65535")
+	fmt.Println("  venom validate --name MyProject")
+	fmt.Println("  venom --scope team-a configure --list")
+	fmt.Println("  venom --profile staging pull")
 }
 
 // convertProjectsToSlice converts the map of projects to a slice.
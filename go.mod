@@ -5,6 +5,8 @@ go 1.23.3
 require (
 	github.com/charmbracelet/bubbletea v1.2.0
 	github.com/joho/godotenv v1.5.1
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/crypto v0.28.0
 )
 
 require (
@@ -1,8 +1,14 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/KaiqueGovani/venom/internal/config"
+	"github.com/KaiqueGovani/venom/internal/db"
 	"github.com/KaiqueGovani/venom/internal/model"
 	"github.com/couchbase/gocb/v2"
 )
@@ -13,19 +19,56 @@ type API interface {
 	CreateProject(project model.Project) (model.Project, error)
 	UpdateProject(projectName string, project model.Project) (model.Project, error)
 	DeleteProject(projectName string) error
+	SetVariable(projectName string, key string, value string) error
+	UnsetVariable(projectName string, key string) error
+	GetHistory(projectName string) ([]model.Revision, error)
+	Rollback(projectName string, revision int) (model.Project, error)
+	ListTrash() ([]model.TrashedProject, error)
+	RestoreProject(projectName string) (model.Project, error)
+	PurgeTrash(projectName string) (int, error)
+	MigrateSchema() (int, error)
+	RenameProject(oldName string, newName string) (model.Project, error)
+	Close() error
 }
 
+var (
+	ErrProjectNotFound  = errors.New("project not found")
+	ErrProjectExists    = errors.New("project already exists")
+	ErrVariableNotFound = errors.New("variable not found")
+
+	ErrEnvironmentNotFound = errors.New("environment not found")
+	ErrRuleNotFound        = errors.New("rule not found")
+)
+
+// ConflictError reports that a project was modified by someone else after it was read.
+type ConflictError struct {
+	ProjectName string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("project %s was modified by someone else since it was read", e.ProjectName)
+}
+
+var _ API = ApiHandler{}
+
 type ApiHandler struct {
 	Bucket             string
 	Scope              string
 	Collection         string
 	Cluster            *gocb.Cluster
 	ProjectsCollection *gocb.Collection
+	History            string
+	HistoryCollection  *gocb.Collection
+	Trash              string
+	TrashCollection    *gocb.Collection
+	TrashRetention     time.Duration
+	Author             string
 }
 
 type GetProjectsResult struct {
-	ID      string        `json:"id"`
-	Project model.Project `json:"projects"`
+	ID       string          `json:"id"`
+	CAS      uint64          `json:"cas"`
+	Document json.RawMessage `json:"projects"`
 }
 
 func NewApiHandler(bucket string, scope string, collection string, cluster *gocb.Cluster, projectsCollection *gocb.Collection) *ApiHandler {
@@ -38,9 +81,37 @@ func NewApiHandler(bucket string, scope string, collection string, cluster *gocb
 	}
 }
 
+// openCouchbase connects to the cluster and returns a handler for the configured collection that owns the connection.
+func openCouchbase(cfg config.Config) (API, error) {
+	retention, err := trashRetention(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster, err := db.Connect(cfg)
+	if errors.Is(err, gocb.ErrTimeout) {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scope := cluster.Bucket(cfg.Bucket).Scope(cfg.Scope)
+
+	handler := NewApiHandler(cfg.Bucket, cfg.Scope, cfg.Collection, cluster, scope.Collection(cfg.Collection))
+	handler.History = cfg.HistoryCollection
+	handler.HistoryCollection = scope.Collection(cfg.HistoryCollection)
+	handler.Trash = cfg.TrashCollection
+	handler.TrashCollection = scope.Collection(cfg.TrashCollection)
+	handler.TrashRetention = retention
+	handler.Author = cfg.Author
+	return handler, nil
+}
+
 func (a ApiHandler) GetProjects() (map[string]model.Project, error) {
 	results, err := a.Cluster.Query(
-		fmt.Sprintf("SELECT META().id, * FROM %s.%s.%s", a.Bucket, a.Scope, a.Collection),
+		// Alias the collection so the result shape does not depend on its configured name
+		fmt.Sprintf("SELECT META(p).id, META(p).cas, p AS projects FROM `%s`.`%s`.`%s` AS p", a.Bucket, a.Scope, a.Collection),
 		&gocb.QueryOptions{
 			// Note that we set Adhoc to true to prevent this query being run as a prepared statement.
 			Adhoc:    true,
@@ -62,7 +133,12 @@ func (a ApiHandler) GetProjects() (map[string]model.Project, error) {
 		}
 
 		// Add the value to the projects map
-		projects[result.ID] = result.Project
+		project, err := decodeDocument(result.ID, result.Document)
+		if err != nil {
+			return nil, err
+		}
+		project.CAS = result.CAS
+		projects[result.ID] = project
 	}
 
 	// always check for errors after iterating
@@ -75,40 +151,145 @@ func (a ApiHandler) GetProjects() (map[string]model.Project, error) {
 }
 
 func (a ApiHandler) GetProject(projectName string) (model.Project, error) {
-	var project model.Project
 	result, err := a.ProjectsCollection.Get(projectName, &gocb.GetOptions{})
 	if err != nil {
-		return project, err
+		return model.Project{}, translateError(projectName, err)
 	}
 
-	err = result.Content(&project)
+	var document json.RawMessage
+	err = result.Content(&document)
+	if err != nil {
+		return model.Project{}, err
+	}
+	project, err := decodeDocument(projectName, document)
 	if err != nil {
 		return project, err
 	}
+	project.CAS = uint64(result.Cas())
 	return project, nil
 }
 
-func (a ApiHandler) CreateProject(project model.Project) (string, error) {
-	key := project.Name
-	_, err := a.ProjectsCollection.Upsert(key, project, nil)
+func (a ApiHandler) CreateProject(project model.Project) (model.Project, error) {
+	project = stampProject(project)
+	result, err := a.ProjectsCollection.Insert(project.Name, project, nil)
 	if err != nil {
-		return "", err
+		return project, translateError(project.Name, err)
 	}
-	return key, nil
+	project.CAS = uint64(result.Cas())
+	return project, a.recordRevision(project.Name, project, model.ActionCreate, "")
 }
 
+// UpdateProject replaces the stored project. When project.CAS is set the write only succeeds
+// if nobody changed the document since it was read, otherwise a *ConflictError is returned.
 func (a ApiHandler) UpdateProject(projectName string, project model.Project) (model.Project, error) {
-	_, err := a.ProjectsCollection.Upsert(projectName, project, nil)
+	project = stampProject(project)
+	result, err := a.ProjectsCollection.Replace(projectName, project, &gocb.ReplaceOptions{
+		Cas: gocb.Cas(project.CAS),
+	})
 	if err != nil {
-		return project, err
+		return project, translateError(projectName, err)
 	}
-	return project, nil
+	project.CAS = uint64(result.Cas())
+	return project, a.recordRevision(projectName, project, model.ActionUpdate, "")
 }
 
+// DeleteProject moves the project to the trash, where it expires after the retention period, and
+// keeps its last state in the history. The removal is CAS-checked against that state so the
+// trashed copy is exactly what was deleted.
 func (a ApiHandler) DeleteProject(projectName string) error {
-	_, err := a.ProjectsCollection.Remove(projectName, nil)
+	project, err := a.GetProject(projectName)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	trashed := newTrashedProject(project, a.Author, a.TrashRetention)
+	_, err = a.TrashCollection.Upsert(projectName, trashed, &gocb.UpsertOptions{Expiry: a.TrashRetention})
+	if err != nil {
+		return fmt.Errorf("failed to move project %s to the trash: %w", projectName, a.collectionHint(a.Trash, err))
+	}
+
+	_, err = a.ProjectsCollection.Remove(projectName, &gocb.RemoveOptions{
+		Cas: gocb.Cas(project.CAS),
+	})
+	if err != nil {
+		// The project is still there, so it must not show up in the trash
+		if _, removeErr := a.TrashCollection.Remove(projectName, nil); removeErr != nil {
+			return fmt.Errorf("%w (its copy could not be taken out of the trash either, remove it with 'venom trash purge %s': %v)",
+				translateError(projectName, err), projectName, removeErr)
+		}
+		return translateError(projectName, err)
+	}
+	return a.recordRevision(projectName, project, model.ActionDelete, "")
+}
+
+// SetVariable upserts a single variable with a sub-document mutation, leaving the rest of the document untouched.
+func (a ApiHandler) SetVariable(projectName string, key string, value string) error {
+	_, err := a.ProjectsCollection.MutateIn(projectName, []gocb.MutateInSpec{
+		gocb.UpsertSpec(variablePath(key), value, &gocb.UpsertSpecOptions{CreatePath: true}),
+		touchSpec(key),
+	}, nil)
+	if errors.Is(err, gocb.ErrPathMismatch) {
+		// Projects created without variables store null, which cannot hold sub-paths
+		_, err = a.ProjectsCollection.MutateIn(projectName, []gocb.MutateInSpec{
+			gocb.UpsertSpec("variables", map[string]string{key: value}, nil),
+			touchSpec(key),
+		}, nil)
+	}
+	if err != nil {
+		return translateError(projectName, err)
+	}
+	return a.recordCurrent(projectName, "set "+key)
+}
+
+// UnsetVariable removes a single variable with a sub-document mutation.
+func (a ApiHandler) UnsetVariable(projectName string, key string) error {
+	_, err := a.ProjectsCollection.MutateIn(projectName, []gocb.MutateInSpec{
+		gocb.RemoveSpec(variablePath(key), nil),
+		touchSpec(key),
+	}, nil)
+	if errors.Is(err, gocb.ErrPathNotFound) || errors.Is(err, gocb.ErrPathMismatch) {
+		return fmt.Errorf("%w: %s in project %s", ErrVariableNotFound, key, projectName)
+	}
+	if err != nil {
+		return translateError(projectName, err)
+	}
+	return a.recordCurrent(projectName, "unset "+key)
+}
+
+// recordCurrent snapshots the project after a sub-document mutation, which does not return the full document.
+func (a ApiHandler) recordCurrent(projectName string, detail string) error {
+	project, err := a.GetProject(projectName)
+	if err != nil {
+		a.warnUnrecorded(projectName, err)
+		return nil
+	}
+	return a.recordRevision(projectName, project, model.ActionUpdate, detail)
+}
+
+func (a ApiHandler) Close() error {
+	return a.Cluster.Close(&gocb.ClusterCloseOptions{})
+}
+
+// variablePath returns the sub-document path of a variable, escaping the key so dots are not treated as nesting.
+func variablePath(key string) string {
+	return "variables.`" + strings.ReplaceAll(key, "`", "``") + "`"
+}
+
+// touchSpec records the modification time of a variable in its metadata.
+func touchSpec(key string) gocb.MutateInSpec {
+	path := "meta.`" + strings.ReplaceAll(key, "`", "``") + "`.modified"
+	return gocb.UpsertSpec(path, time.Now().UTC(), &gocb.UpsertSpecOptions{CreatePath: true})
+}
+
+// translateError maps Couchbase document errors to the backend-agnostic API errors.
+func translateError(projectName string, err error) error {
+	switch {
+	case errors.Is(err, gocb.ErrCasMismatch):
+		return &ConflictError{ProjectName: projectName}
+	case errors.Is(err, gocb.ErrDocumentNotFound):
+		return fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+	case errors.Is(err, gocb.ErrDocumentExists):
+		return fmt.Errorf("%w: %s", ErrProjectExists, projectName)
+	}
+	return err
 }
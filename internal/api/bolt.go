@@ -0,0 +1,530 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/KaiqueGovani/venom/internal/config"
+	"github.com/KaiqueGovani/venom/internal/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ API = (*BoltHandler)(nil)
+
+var (
+	projectsBucket = []byte("projects")
+	casBucket      = []byte("cas")
+	historyBucket  = []byte("history")
+	trashBucket    = []byte("trash")
+)
+
+// BoltHandler stores projects in a single embedded BoltDB file, so no server is needed.
+type BoltHandler struct {
+	Author         string
+	TrashRetention time.Duration
+
+	db *bolt.DB
+}
+
+func init() {
+	Register("local", func(cfg config.Config) (API, error) {
+		retention, err := trashRetention(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		path := cfg.LocalPath
+		if path == "" {
+			path, err = DefaultBoltPath()
+			if err != nil {
+				return nil, err
+			}
+		}
+		handler, err := NewBoltHandler(path)
+		if err != nil {
+			return nil, err
+		}
+		handler.Author = cfg.Author
+		handler.TrashRetention = retention
+		return handler, nil
+	})
+}
+
+// DefaultBoltPath returns the database file location inside the user's config directory.
+func DefaultBoltPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "venom", "venom.db"), nil
+}
+
+func NewBoltHandler(path string) (*BoltHandler, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("database %s is locked by another venom process", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{projectsBucket, casBucket, historyBucket, trashBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltHandler{db: db}, nil
+}
+
+func (b *BoltHandler) GetProjects() (map[string]model.Project, error) {
+	projects := make(map[string]model.Project)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(projectsBucket).ForEach(func(k, v []byte) error {
+			project, err := decodeProject(tx, k, v)
+			if err != nil {
+				return err
+			}
+			projects[string(k)] = project
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+func (b *BoltHandler) GetProject(projectName string) (model.Project, error) {
+	var project model.Project
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(projectsBucket).Get([]byte(projectName))
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+		}
+		var err error
+		project, err = decodeProject(tx, []byte(projectName), data)
+		return err
+	})
+	return project, err
+}
+
+func (b *BoltHandler) CreateProject(project model.Project) (model.Project, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(projectsBucket).Get([]byte(project.Name)) != nil {
+			return fmt.Errorf("%w: %s", ErrProjectExists, project.Name)
+		}
+		var err error
+		project.CAS, err = b.save(tx, project.Name, project, model.ActionCreate, "")
+		return err
+	})
+	return project, err
+}
+
+func (b *BoltHandler) UpdateProject(projectName string, project model.Project) (model.Project, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(projectsBucket).Get([]byte(projectName)) == nil {
+			return fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+		}
+		if project.CAS != 0 && project.CAS != readCAS(tx, []byte(projectName)) {
+			return &ConflictError{ProjectName: projectName}
+		}
+		var err error
+		project.CAS, err = b.save(tx, projectName, project, model.ActionUpdate, "")
+		return err
+	})
+	return project, err
+}
+
+func (b *BoltHandler) DeleteProject(projectName string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(projectsBucket)
+		data := bucket.Get([]byte(projectName))
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+		}
+		project, err := decodeProject(tx, []byte(projectName), data)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(casBucket).Delete([]byte(projectName)); err != nil {
+			return err
+		}
+		if err := bucket.Delete([]byte(projectName)); err != nil {
+			return err
+		}
+
+		trashed, err := json.Marshal(newTrashedProject(project, b.Author, b.TrashRetention))
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(trashBucket).Put([]byte(projectName), trashed); err != nil {
+			return err
+		}
+		return b.recordRevision(tx, projectName, project, model.ActionDelete, "")
+	})
+}
+
+func (b *BoltHandler) SetVariable(projectName string, key string, value string) error {
+	return b.updateVariables(projectName, key, "set "+key, func(variables map[string]string) error {
+		variables[key] = value
+		return nil
+	})
+}
+
+func (b *BoltHandler) UnsetVariable(projectName string, key string) error {
+	return b.updateVariables(projectName, key, "unset "+key, func(variables map[string]string) error {
+		if _, ok := variables[key]; !ok {
+			return fmt.Errorf("%w: %s in project %s", ErrVariableNotFound, key, projectName)
+		}
+		delete(variables, key)
+		return nil
+	})
+}
+
+// updateVariables applies fn to a project's variables inside a single write transaction,
+// recording when key was modified.
+func (b *BoltHandler) updateVariables(projectName string, key string, detail string, fn func(map[string]string) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(projectsBucket).Get([]byte(projectName))
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+		}
+		project, err := decodeProject(tx, []byte(projectName), data)
+		if err != nil {
+			return err
+		}
+		if project.Variables == nil {
+			project.Variables = make(map[string]string)
+		}
+		if err := fn(project.Variables); err != nil {
+			return err
+		}
+		project.TouchIn(model.DefaultEnvironment, key, time.Now())
+		_, err = b.save(tx, projectName, project, model.ActionUpdate, detail)
+		return err
+	})
+}
+
+func (b *BoltHandler) GetHistory(projectName string) ([]model.Revision, error) {
+	var history []model.Revision
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket).Bucket([]byte(projectName))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			var revision model.Revision
+			if err := json.Unmarshal(v, &revision); err != nil {
+				return fmt.Errorf("failed to decode revision of project %s: %w", projectName, err)
+			}
+			history = append(history, revision)
+			return nil
+		})
+	})
+	return history, err
+}
+
+func (b *BoltHandler) Rollback(projectName string, number int) (model.Project, error) {
+	history, err := b.GetHistory(projectName)
+	if err != nil {
+		return model.Project{}, err
+	}
+	revision, err := findRevision(history, projectName, number)
+	if err != nil {
+		return model.Project{}, err
+	}
+
+	project := revision.Snapshot
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(projectsBucket).Get([]byte(projectName)) == nil {
+			// Bringing back a deleted project takes it out of the trash
+			if err := tx.Bucket(trashBucket).Delete([]byte(projectName)); err != nil {
+				return err
+			}
+		}
+		var err error
+		project.CAS, err = b.save(tx, projectName, project, model.ActionRollback, rollbackDetail(number))
+		return err
+	})
+	return project, err
+}
+
+func (b *BoltHandler) ListTrash() ([]model.TrashedProject, error) {
+	var trash []model.TrashedProject
+	err := b.db.View(func(tx *bolt.Tx) error {
+		now := time.Now()
+		return tx.Bucket(trashBucket).ForEach(func(k, v []byte) error {
+			trashed, err := decodeTrashed(k, v)
+			if err != nil {
+				return err
+			}
+			if !trashed.Expired(now) {
+				trash = append(trash, trashed)
+			}
+			return nil
+		})
+	})
+	sortTrash(trash)
+	return trash, err
+}
+
+func (b *BoltHandler) RestoreProject(projectName string) (model.Project, error) {
+	var project model.Project
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(trashBucket).Get([]byte(projectName))
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrNotInTrash, projectName)
+		}
+		trashed, err := decodeTrashed([]byte(projectName), data)
+		if err != nil {
+			return err
+		}
+		if trashed.Expired(time.Now()) {
+			return fmt.Errorf("%w: %s", ErrNotInTrash, projectName)
+		}
+		if tx.Bucket(projectsBucket).Get([]byte(projectName)) != nil {
+			return fmt.Errorf("%w: %s", ErrProjectExists, projectName)
+		}
+
+		project = trashed.Project
+		project.CAS, err = b.save(tx, projectName, project, model.ActionRestore, "from trash")
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(trashBucket).Delete([]byte(projectName))
+	})
+	return project, err
+}
+
+func (b *BoltHandler) PurgeTrash(projectName string) (int, error) {
+	purged := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(trashBucket)
+		if projectName != "" {
+			if bucket.Get([]byte(projectName)) == nil {
+				return fmt.Errorf("%w: %s", ErrNotInTrash, projectName)
+			}
+			purged = 1
+			return bucket.Delete([]byte(projectName))
+		}
+
+		// Deleting while iterating with ForEach is not allowed, so collect the keys first
+		var keys [][]byte
+		bucket.ForEach(func(k, _ []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		purged = len(keys)
+		return nil
+	})
+	return purged, err
+}
+
+func (b *BoltHandler) RenameProject(oldName string, newName string) (model.Project, error) {
+	if err := validateRename(oldName, newName); err != nil {
+		return model.Project{}, err
+	}
+
+	var project model.Project
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		projects := tx.Bucket(projectsBucket)
+		data := projects.Get([]byte(oldName))
+		if data == nil {
+			return fmt.Errorf("%w: %s", ErrProjectNotFound, oldName)
+		}
+		if projects.Get([]byte(newName)) != nil {
+			return fmt.Errorf("%w: %s", ErrProjectExists, newName)
+		}
+		var err error
+		project, err = decodeProject(tx, []byte(oldName), data)
+		if err != nil {
+			return err
+		}
+		if err := projects.Delete([]byte(oldName)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(casBucket).Delete([]byte(oldName)); err != nil {
+			return err
+		}
+		if err := moveHistory(tx, oldName, newName); err != nil {
+			return err
+		}
+
+		project.Name = newName
+		project.CAS, err = b.save(tx, newName, project, model.ActionRename, renameDetail(oldName))
+		return err
+	})
+	return project, err
+}
+
+// moveHistory appends the revisions of oldName to the history of newName and drops the old bucket.
+func moveHistory(tx *bolt.Tx, oldName string, newName string) error {
+	history := tx.Bucket(historyBucket)
+	source := history.Bucket([]byte(oldName))
+	if source == nil {
+		return nil
+	}
+	target, err := history.CreateBucketIfNotExists([]byte(newName))
+	if err != nil {
+		return err
+	}
+
+	err = source.ForEach(func(_, v []byte) error {
+		var revision model.Revision
+		if err := json.Unmarshal(v, &revision); err != nil {
+			return fmt.Errorf("failed to decode revision of project %s: %w", oldName, err)
+		}
+		number, err := target.NextSequence()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(renamedRevision(revision, newName, int(number)))
+		if err != nil {
+			return err
+		}
+		return target.Put(binary.BigEndian.AppendUint64(nil, number), data)
+	})
+	if err != nil {
+		return err
+	}
+	return history.DeleteBucket([]byte(oldName))
+}
+
+// MigrateSchema rewrites every project stored with an older schema version in a single transaction.
+func (b *BoltHandler) MigrateSchema() (int, error) {
+	migrated := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		// Writing while iterating with ForEach is not allowed, so collect the outdated projects first
+		outdated := map[string]model.Project{}
+		err := tx.Bucket(projectsBucket).ForEach(func(k, v []byte) error {
+			project, err := decodeProject(tx, k, v)
+			if err != nil {
+				return err
+			}
+			var stored struct {
+				SchemaVersion int `json:"schema_version"`
+			}
+			if err := json.Unmarshal(v, &stored); err != nil {
+				return err
+			}
+			if stored.SchemaVersion < model.CurrentSchemaVersion {
+				outdated[string(k)] = project
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for name, project := range outdated {
+			if _, err := putProject(tx, name, project); err != nil {
+				return err
+			}
+		}
+		migrated = len(outdated)
+		return nil
+	})
+	return migrated, err
+}
+
+func (b *BoltHandler) Close() error {
+	return b.db.Close()
+}
+
+func decodeProject(tx *bolt.Tx, key, data []byte) (model.Project, error) {
+	project, err := decodeDocument(string(key), data)
+	if err != nil {
+		return project, err
+	}
+	project.CAS = readCAS(tx, key)
+	return project, nil
+}
+
+func readCAS(tx *bolt.Tx, key []byte) uint64 {
+	data := tx.Bucket(casBucket).Get(key)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+func decodeTrashed(key, data []byte) (model.TrashedProject, error) {
+	var trashed model.TrashedProject
+	if err := json.Unmarshal(data, &trashed); err != nil {
+		return trashed, fmt.Errorf("failed to decode trashed project %s: %w", key, err)
+	}
+	return trashed, nil
+}
+
+// save stores the project and records the change in its history, returning the new CAS.
+func (b *BoltHandler) save(tx *bolt.Tx, projectName string, project model.Project, action string, detail string) (uint64, error) {
+	cas, err := putProject(tx, projectName, project)
+	if err != nil {
+		return 0, err
+	}
+	return cas, b.recordRevision(tx, projectName, project, action, detail)
+}
+
+// recordRevision appends a revision to the project's history bucket, numbered by the bucket sequence.
+func (b *BoltHandler) recordRevision(tx *bolt.Tx, projectName string, project model.Project, action string, detail string) error {
+	bucket, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(projectName))
+	if err != nil {
+		return err
+	}
+	number, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(model.Revision{
+		Number:    int(number),
+		Project:   projectName,
+		Action:    action,
+		Detail:    detail,
+		Author:    b.Author,
+		Timestamp: time.Now().UTC(),
+		Snapshot:  project,
+	})
+	if err != nil {
+		return err
+	}
+	return bucket.Put(binary.BigEndian.AppendUint64(nil, number), data)
+}
+
+// putProject stores the project and bumps its CAS, returning the new value.
+func putProject(tx *bolt.Tx, key string, project model.Project) (uint64, error) {
+	data, err := json.Marshal(stampProject(project))
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Bucket(projectsBucket).Put([]byte(key), data); err != nil {
+		return 0, err
+	}
+
+	cas, err := tx.Bucket(casBucket).NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	return cas, tx.Bucket(casBucket).Put([]byte(key), binary.BigEndian.AppendUint64(nil, cas))
+}
@@ -0,0 +1,694 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/KaiqueGovani/venom/internal/config"
+	"github.com/KaiqueGovani/venom/internal/model"
+)
+
+var (
+	// ErrUnavailable is returned by remote openers when the server cannot be reached.
+	ErrUnavailable = errors.New("backend is unreachable")
+	ErrOffline     = errors.New("not available while offline")
+)
+
+var _ API = (*CachedHandler)(nil)
+
+// Actions of changes queued while offline.
+const (
+	PendingCreate = "create"
+	PendingUpdate = "update"
+	PendingDelete = "delete"
+	PendingSet    = "set"
+	PendingUnset  = "unset"
+)
+
+// PendingChange is an edit made while offline, replayed against the server by Sync.
+type PendingChange struct {
+	Action  string `json:"action"`
+	Project string `json:"project"`
+	Key     string `json:"key,omitempty"`
+	Value   string `json:"value,omitempty"`
+	// Previous is the variable value the change was made against, nil when it was not set.
+	Previous *string       `json:"previous,omitempty"`
+	Snapshot model.Project `json:"snapshot"`
+	// BaseCAS is the server version the change was made against. It is zero when the change
+	// follows another queued change to the same project, whose outcome decides its base.
+	BaseCAS  uint64    `json:"base_cas"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// Outcomes of replaying a pending change.
+const (
+	SyncApplied  = "applied"
+	SyncConflict = "conflict"
+	SyncBlocked  = "blocked"
+)
+
+// SyncResult describes what happened to one pending change.
+type SyncResult struct {
+	Change  PendingChange
+	Outcome string
+	Err     error
+}
+
+type cachedProject struct {
+	Project model.Project `json:"project"`
+	CAS     uint64        `json:"cas"`
+}
+
+// cacheFile holds the last known server state and the changes queued on top of it.
+type cacheFile struct {
+	SyncedAt time.Time                `json:"synced_at"`
+	Projects map[string]cachedProject `json:"projects"`
+	Pending  []PendingChange          `json:"pending"`
+}
+
+// CachedHandler wraps a remote backend, keeping a local copy of its projects. When the
+// server could not be reached it serves reads from that copy and queues edits until Sync.
+type CachedHandler struct {
+	remote API
+	path   string
+
+	mu    sync.Mutex
+	cache cacheFile
+	// warned is set once a failed cache write has been reported
+	warned bool
+}
+
+// openCached wraps the result of a remote opener, falling back to the cache when the server is unreachable.
+func openCached(cfg config.Config, remote API, openErr error) (API, error) {
+	path, err := cachePath(cfg)
+	if err != nil {
+		if remote != nil {
+			remote.Close()
+		}
+		return nil, err
+	}
+
+	if openErr != nil {
+		if !errors.Is(openErr, ErrUnavailable) {
+			return nil, openErr
+		}
+		if _, err := os.Stat(path); err != nil {
+			// Nothing was cached yet, so there is nothing to work offline with
+			return nil, openErr
+		}
+		return NewCachedHandler(nil, path)
+	}
+
+	handler, err := NewCachedHandler(remote, path)
+	if err != nil {
+		remote.Close()
+		return nil, err
+	}
+	return handler, nil
+}
+
+// cachePath returns the configured cache file, or one per profile and collection in the user cache directory.
+func cachePath(cfg config.Config) (string, error) {
+	if cfg.CachePath != "" {
+		return cfg.CachePath, nil
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user cache directory: %w", err)
+	}
+	profile := cfg.Profile
+	if profile == "" {
+		profile = "default"
+	}
+	name := fmt.Sprintf("%s-%s-%s.%s.%s.json", profile, cfg.Backend, cfg.Bucket, cfg.Scope, cfg.Collection)
+	return filepath.Join(cacheDir, "venom", name), nil
+}
+
+// NewCachedHandler loads the cache at path. A nil remote makes the handler work offline.
+func NewCachedHandler(remote API, path string) (*CachedHandler, error) {
+	c := &CachedHandler{remote: remote, path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read offline cache: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &c.cache); err != nil {
+			return nil, fmt.Errorf("failed to read offline cache %s: %w", path, err)
+		}
+	}
+	if c.cache.Projects == nil {
+		c.cache.Projects = make(map[string]cachedProject)
+	}
+	return c, nil
+}
+
+// AsCached returns the offline cache underneath a handler returned by Open, if it has one.
+func AsCached(handler API) (*CachedHandler, bool) {
+	for {
+		switch h := handler.(type) {
+		case *CachedHandler:
+			return h, true
+		case interface{ Unwrap() API }:
+			handler = h.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// Offline reports whether the server was unreachable when the handler was opened.
+func (c *CachedHandler) Offline() bool {
+	return c.remote == nil
+}
+
+// SyncedAt returns when the cached projects were last read from the server.
+func (c *CachedHandler) SyncedAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cache.SyncedAt
+}
+
+// Pending returns the changes waiting to be synced, oldest first.
+func (c *CachedHandler) Pending() []PendingChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := make([]PendingChange, len(c.cache.Pending))
+	copy(pending, c.cache.Pending)
+	return pending
+}
+
+// Discard drops every pending change.
+func (c *CachedHandler) Discard() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pending := c.cache.Pending
+	c.cache.Pending = nil
+	if err := c.save(); err != nil {
+		c.cache.Pending = pending
+		return 0, err
+	}
+	return len(pending), nil
+}
+
+func (c *CachedHandler) GetProjects() (map[string]model.Project, error) {
+	if c.Offline() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		projects := make(map[string]model.Project)
+		for name, cached := range c.view() {
+			projects[name] = cached.project()
+		}
+		return projects, nil
+	}
+
+	projects, err := c.remote.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache.Projects = make(map[string]cachedProject, len(projects))
+	for name, project := range projects {
+		c.cache.Projects[name] = cachedProject{Project: cloneProject(project), CAS: project.CAS}
+	}
+	c.cache.SyncedAt = time.Now().UTC()
+	c.keep()
+	return projects, nil
+}
+
+func (c *CachedHandler) GetProject(projectName string) (model.Project, error) {
+	if c.Offline() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		cached, ok := c.view()[projectName]
+		if !ok {
+			return model.Project{}, fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+		}
+		return cached.project(), nil
+	}
+
+	project, err := c.remote.GetProject(projectName)
+	if errors.Is(err, ErrProjectNotFound) {
+		c.forget(projectName)
+	}
+	if err != nil {
+		return project, err
+	}
+	c.remember(project)
+	return project, nil
+}
+
+func (c *CachedHandler) CreateProject(project model.Project) (model.Project, error) {
+	if c.Offline() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if _, ok := c.view()[project.Name]; ok {
+			return project, fmt.Errorf("%w: %s", ErrProjectExists, project.Name)
+		}
+		return project, c.queue(PendingChange{Action: PendingCreate, Project: project.Name, Snapshot: project})
+	}
+
+	project, err := c.remote.CreateProject(project)
+	if err == nil {
+		c.remember(project)
+	}
+	return project, err
+}
+
+func (c *CachedHandler) UpdateProject(projectName string, project model.Project) (model.Project, error) {
+	if c.Offline() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		current, ok := c.view()[projectName]
+		if !ok {
+			return project, fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+		}
+		if project.CAS != 0 && project.CAS != current.CAS {
+			return project, &ConflictError{ProjectName: projectName}
+		}
+		project.CAS = current.CAS
+		return project, c.queue(PendingChange{Action: PendingUpdate, Project: projectName, Snapshot: project})
+	}
+
+	project, err := c.remote.UpdateProject(projectName, project)
+	if err == nil {
+		c.remember(project)
+	}
+	return project, err
+}
+
+func (c *CachedHandler) DeleteProject(projectName string) error {
+	if c.Offline() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if _, ok := c.view()[projectName]; !ok {
+			return fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+		}
+		return c.queue(PendingChange{Action: PendingDelete, Project: projectName})
+	}
+
+	err := c.remote.DeleteProject(projectName)
+	if err == nil {
+		c.forget(projectName)
+	}
+	return err
+}
+
+func (c *CachedHandler) SetVariable(projectName string, key string, value string) error {
+	if c.Offline() {
+		return c.queueVariable(PendingChange{Action: PendingSet, Project: projectName, Key: key, Value: value})
+	}
+
+	if err := c.remote.SetVariable(projectName, key, value); err != nil {
+		return err
+	}
+	c.reload(projectName)
+	return nil
+}
+
+func (c *CachedHandler) UnsetVariable(projectName string, key string) error {
+	if c.Offline() {
+		return c.queueVariable(PendingChange{Action: PendingUnset, Project: projectName, Key: key})
+	}
+
+	if err := c.remote.UnsetVariable(projectName, key); err != nil {
+		return err
+	}
+	c.reload(projectName)
+	return nil
+}
+
+func (c *CachedHandler) GetHistory(projectName string) ([]model.Revision, error) {
+	if c.Offline() {
+		return nil, fmt.Errorf("%w: history", ErrOffline)
+	}
+	return c.remote.GetHistory(projectName)
+}
+
+func (c *CachedHandler) Rollback(projectName string, revision int) (model.Project, error) {
+	if c.Offline() {
+		return model.Project{}, fmt.Errorf("%w: rollback", ErrOffline)
+	}
+	project, err := c.remote.Rollback(projectName, revision)
+	if err == nil {
+		c.remember(project)
+	}
+	return project, err
+}
+
+func (c *CachedHandler) ListTrash() ([]model.TrashedProject, error) {
+	if c.Offline() {
+		return nil, fmt.Errorf("%w: trash", ErrOffline)
+	}
+	return c.remote.ListTrash()
+}
+
+func (c *CachedHandler) RestoreProject(projectName string) (model.Project, error) {
+	if c.Offline() {
+		return model.Project{}, fmt.Errorf("%w: trash", ErrOffline)
+	}
+	project, err := c.remote.RestoreProject(projectName)
+	if err == nil {
+		c.remember(project)
+	}
+	return project, err
+}
+
+func (c *CachedHandler) PurgeTrash(projectName string) (int, error) {
+	if c.Offline() {
+		return 0, fmt.Errorf("%w: trash", ErrOffline)
+	}
+	return c.remote.PurgeTrash(projectName)
+}
+
+func (c *CachedHandler) MigrateSchema() (int, error) {
+	if c.Offline() {
+		return 0, fmt.Errorf("%w: schema migration", ErrOffline)
+	}
+	return c.remote.MigrateSchema()
+}
+
+func (c *CachedHandler) RenameProject(oldName string, newName string) (model.Project, error) {
+	if c.Offline() {
+		return model.Project{}, fmt.Errorf("%w: rename", ErrOffline)
+	}
+	project, err := c.remote.RenameProject(oldName, newName)
+	if err == nil {
+		c.forget(oldName)
+		c.remember(project)
+	}
+	return project, err
+}
+
+func (c *CachedHandler) Close() error {
+	if c.Offline() {
+		return nil
+	}
+	return c.remote.Close()
+}
+
+// Sync replays the pending changes against the server in the order they were made. A change
+// whose project was modified on the server since it was read is a conflict: it stays queued
+// together with every later change to the same project, unless force overwrites the server.
+// Any other error stops the sync, keeping the failed change and everything after it.
+func (c *CachedHandler) Sync(force bool) ([]SyncResult, error) {
+	if c.Offline() {
+		return nil, fmt.Errorf("%w: sync needs a connection to the server", ErrOffline)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var results []SyncResult
+	var remaining []PendingChange
+	bases := map[string]uint64{}
+	blocked := map[string]bool{}
+
+	for i, change := range c.cache.Pending {
+		if blocked[change.Project] {
+			remaining = append(remaining, change)
+			results = append(results, SyncResult{Change: change, Outcome: SyncBlocked})
+			continue
+		}
+		if base, ok := bases[change.Project]; ok && change.BaseCAS == 0 {
+			change.BaseCAS = base
+		}
+
+		err := c.replay(change, force)
+		var conflict *ConflictError
+		if errors.As(err, &conflict) {
+			blocked[change.Project] = true
+			remaining = append(remaining, change)
+			results = append(results, SyncResult{Change: change, Outcome: SyncConflict, Err: err})
+			continue
+		}
+		if err == nil {
+			bases[change.Project], err = c.serverCAS(change.Project)
+		}
+		if err != nil {
+			c.cache.Pending = append(remaining, rebase(c.cache.Pending[i:], bases)...)
+			err = fmt.Errorf("sync stopped at %s of project %s: %w", change.Action, change.Project, err)
+			return results, errors.Join(err, c.save())
+		}
+		results = append(results, SyncResult{Change: change, Outcome: SyncApplied})
+	}
+	c.cache.Pending = remaining
+
+	// Start again from the server state, which now includes the applied changes
+	projects, err := c.remote.GetProjects()
+	if err != nil {
+		return results, errors.Join(err, c.save())
+	}
+	c.cache.Projects = make(map[string]cachedProject, len(projects))
+	for name, project := range projects {
+		c.cache.Projects[name] = cachedProject{Project: cloneProject(project), CAS: project.CAS}
+	}
+	c.cache.SyncedAt = time.Now().UTC()
+	return results, c.save()
+}
+
+// replay applies a single pending change to the server, reporting a *ConflictError when the
+// project changed there since the change was made.
+func (c *CachedHandler) replay(change PendingChange, force bool) error {
+	name := change.Project
+	conflict := &ConflictError{ProjectName: name}
+
+	switch change.Action {
+	case PendingCreate:
+		project := change.Snapshot
+		project.CAS = 0
+		_, err := c.remote.CreateProject(project)
+		if errors.Is(err, ErrProjectExists) {
+			if !force {
+				return conflict
+			}
+			_, err = c.remote.UpdateProject(name, project)
+		}
+		return err
+
+	case PendingUpdate:
+		project := change.Snapshot
+		project.CAS = change.BaseCAS
+		if force {
+			project.CAS = 0
+		}
+		_, err := c.remote.UpdateProject(name, project)
+		if errors.Is(err, ErrProjectNotFound) {
+			if !force {
+				return conflict
+			}
+			_, err = c.remote.CreateProject(project)
+		}
+		return err
+
+	case PendingDelete:
+		if !force && change.BaseCAS != 0 {
+			current, err := c.remote.GetProject(name)
+			if errors.Is(err, ErrProjectNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if current.CAS != change.BaseCAS {
+				return conflict
+			}
+		}
+		err := c.remote.DeleteProject(name)
+		if errors.Is(err, ErrProjectNotFound) {
+			return nil
+		}
+		return err
+
+	case PendingSet, PendingUnset:
+		if !force && change.BaseCAS != 0 {
+			current, err := c.remote.GetProject(name)
+			if errors.Is(err, ErrProjectNotFound) {
+				return conflict
+			}
+			if err != nil {
+				return err
+			}
+			// Edits to other variables do not get in the way
+			value, ok := current.Variables[change.Key]
+			if current.CAS != change.BaseCAS && !sameValue(value, ok, change.Previous) {
+				return conflict
+			}
+		}
+		if change.Action == PendingSet {
+			return c.remote.SetVariable(name, change.Key, change.Value)
+		}
+		err := c.remote.UnsetVariable(name, change.Key)
+		if errors.Is(err, ErrVariableNotFound) {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown pending action %q", change.Action)
+}
+
+// serverCAS returns the current server version of a project, zero once it is deleted.
+func (c *CachedHandler) serverCAS(projectName string) (uint64, error) {
+	project, err := c.remote.GetProject(projectName)
+	if errors.Is(err, ErrProjectNotFound) {
+		return 0, nil
+	}
+	return project.CAS, err
+}
+
+// rebase gives the first remaining change of each project the base left by the changes already applied.
+func rebase(pending []PendingChange, bases map[string]uint64) []PendingChange {
+	rebased := make([]PendingChange, len(pending))
+	seen := map[string]bool{}
+	for i, change := range pending {
+		if base, ok := bases[change.Project]; ok && !seen[change.Project] && change.BaseCAS == 0 {
+			change.BaseCAS = base
+		}
+		seen[change.Project] = true
+		rebased[i] = change
+	}
+	return rebased
+}
+
+func sameValue(value string, ok bool, previous *string) bool {
+	if previous == nil {
+		return !ok
+	}
+	return ok && value == *previous
+}
+
+// queueVariable validates a variable change against the offline view and queues it.
+func (c *CachedHandler) queueVariable(change PendingChange) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current, ok := c.view()[change.Project]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrProjectNotFound, change.Project)
+	}
+	if value, ok := current.Project.Variables[change.Key]; ok {
+		change.Previous = &value
+	} else if change.Action == PendingUnset {
+		return fmt.Errorf("%w: %s in project %s", ErrVariableNotFound, change.Key, change.Project)
+	}
+	return c.queue(change)
+}
+
+// queue records a change made offline. The caller must hold the lock.
+func (c *CachedHandler) queue(change PendingChange) error {
+	change.QueuedAt = time.Now().UTC()
+	change.Snapshot.CAS = 0
+	change.BaseCAS = c.cache.Projects[change.Project].CAS
+	for _, pending := range c.cache.Pending {
+		if pending.Project == change.Project {
+			change.BaseCAS = 0
+			break
+		}
+	}
+	c.cache.Pending = append(c.cache.Pending, change)
+	if err := c.save(); err != nil {
+		// A change that is not on disk would be lost on exit, so it is not queued at all
+		c.cache.Pending = c.cache.Pending[:len(c.cache.Pending)-1]
+		return err
+	}
+	return nil
+}
+
+// view returns the cached server projects with the pending changes applied. The caller must hold the lock.
+func (c *CachedHandler) view() map[string]cachedProject {
+	view := make(map[string]cachedProject, len(c.cache.Projects))
+	for name, cached := range c.cache.Projects {
+		view[name] = cached
+	}
+	for _, change := range c.cache.Pending {
+		cached := view[change.Project]
+		switch change.Action {
+		case PendingCreate, PendingUpdate:
+			view[change.Project] = cachedProject{Project: change.Snapshot, CAS: cached.CAS}
+		case PendingDelete:
+			delete(view, change.Project)
+		case PendingSet:
+			cached.Project = cloneProject(cached.Project)
+			if cached.Project.Variables == nil {
+				cached.Project.Variables = make(map[string]string)
+			}
+			cached.Project.Variables[change.Key] = change.Value
+			view[change.Project] = cached
+		case PendingUnset:
+			cached.Project = cloneProject(cached.Project)
+			delete(cached.Project.Variables, change.Key)
+			view[change.Project] = cached
+		}
+	}
+	return view
+}
+
+func (p cachedProject) project() model.Project {
+	project := cloneProject(p.Project)
+	project.CAS = p.CAS
+	return project
+}
+
+// remember stores the server state of a project.
+func (c *CachedHandler) remember(project model.Project) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cache.Projects[project.Name] = cachedProject{Project: cloneProject(project), CAS: project.CAS}
+	c.keep()
+}
+
+func (c *CachedHandler) forget(projectName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.cache.Projects, projectName)
+	c.keep()
+}
+
+// keep saves the cache after a change the server already holds, so a failed write does not
+// fail the change. It is reported once, since offline mode would then serve older data.
+// The caller must hold the lock.
+func (c *CachedHandler) keep() {
+	if err := c.save(); err != nil && !c.warned {
+		c.warned = true
+		fmt.Fprintf(os.Stderr, "Warning: %v; offline mode will use older data\n", err)
+	}
+}
+
+// reload refreshes a project after a mutation that does not return it.
+func (c *CachedHandler) reload(projectName string) {
+	if project, err := c.remote.GetProject(projectName); err == nil {
+		c.remember(project)
+	}
+}
+
+// save writes the cache in one step, readable only by the user since it holds variable values.
+func (c *CachedHandler) save() error {
+	data, err := json.Marshal(c.cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return fmt.Errorf("failed to write offline cache: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write offline cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to write offline cache: %w", err)
+	}
+	return nil
+}
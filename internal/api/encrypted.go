@@ -0,0 +1,380 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KaiqueGovani/venom/internal/config"
+	"github.com/KaiqueGovani/venom/internal/envelope"
+	"github.com/KaiqueGovani/venom/internal/model"
+)
+
+var ErrNoEncryptionKey = errors.New("project is encrypted but no encryption key is configured")
+
+// UnreadableError is returned by GetProjects together with the projects it could decrypt,
+// so one project sealed with another key does not hide all the others.
+type UnreadableError struct {
+	// Projects maps the name of each project left out to why it could not be decrypted.
+	Projects map[string]error
+}
+
+func (e *UnreadableError) Error() string {
+	names := make([]string, 0, len(e.Projects))
+	for name := range e.Projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	messages := make([]string, len(names))
+	for i, name := range names {
+		messages[i] = e.Projects[name].Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+var _ API = (*EncryptedHandler)(nil)
+
+// EncryptedHandler encrypts variable values before they reach the wrapped backend and
+// decrypts them on the way back, so the backend only ever stores ciphertext. Without a
+// master key it passes plaintext projects through and refuses encrypted ones.
+type EncryptedHandler struct {
+	API
+	master *envelope.MasterKey
+}
+
+// withEncryption wraps an opened backend with the configured master key.
+func withEncryption(cfg config.Config, handler API, err error) (API, error) {
+	if err != nil {
+		return nil, err
+	}
+	master, err := masterKey(cfg)
+	if err != nil {
+		handler.Close()
+		return nil, err
+	}
+	return &EncryptedHandler{API: handler, master: master}, nil
+}
+
+func masterKey(cfg config.Config) (*envelope.MasterKey, error) {
+	switch {
+	case cfg.EncryptionKeyFile != "" && cfg.EncryptionPassphraseEnv != "":
+		return nil, errors.New("set only one of encryption_key_file and encryption_passphrase_env")
+	case cfg.EncryptionKeyFile != "":
+		return envelope.LoadKeyFile(cfg.EncryptionKeyFile)
+	case cfg.EncryptionPassphraseEnv != "":
+		passphrase := os.Getenv(cfg.EncryptionPassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("environment variable %s holding the encryption passphrase is not set", cfg.EncryptionPassphraseEnv)
+		}
+		return envelope.FromPassphrase(passphrase)
+	}
+	return nil, nil
+}
+
+// Unwrap returns the backend holding the ciphertext.
+func (e *EncryptedHandler) Unwrap() API {
+	return e.API
+}
+
+// Stored returns the backend underneath client-side encryption, which reads and writes
+// projects exactly as they are stored, so encrypted values stay ciphertext.
+func Stored(handler API) API {
+	if encrypted, ok := handler.(*EncryptedHandler); ok {
+		return encrypted.Unwrap()
+	}
+	return handler
+}
+
+// EncryptsWrites reports whether a handler returned by Open encrypts the projects it writes.
+func EncryptsWrites(handler API) bool {
+	encrypted, ok := handler.(*EncryptedHandler)
+	return ok && encrypted.Encrypting()
+}
+
+// Encrypting reports whether new writes are encrypted.
+func (e *EncryptedHandler) Encrypting() bool {
+	return e.master != nil
+}
+
+// CheckKey reports whether the master key can decrypt a project as it is stored.
+func (e *EncryptedHandler) CheckKey(project model.Project) error {
+	if project.Encryption == nil {
+		return nil
+	}
+	_, err := e.dataKey(project)
+	return err
+}
+
+func (e *EncryptedHandler) GetProjects() (map[string]model.Project, error) {
+	projects, err := e.API.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+	unreadable := make(map[string]error)
+	for name, project := range projects {
+		decrypted, err := e.decrypt(project)
+		if err != nil {
+			unreadable[name] = err
+			delete(projects, name)
+			continue
+		}
+		projects[name] = decrypted
+	}
+	if len(unreadable) > 0 {
+		return projects, &UnreadableError{Projects: unreadable}
+	}
+	return projects, nil
+}
+
+func (e *EncryptedHandler) GetProject(projectName string) (model.Project, error) {
+	return e.decrypted(e.API.GetProject(projectName))
+}
+
+func (e *EncryptedHandler) CreateProject(project model.Project) (model.Project, error) {
+	sealed, err := e.encrypt(project)
+	if err != nil {
+		return project, err
+	}
+	stored, err := e.API.CreateProject(sealed)
+	return withStored(project, sealed, stored), err
+}
+
+func (e *EncryptedHandler) UpdateProject(projectName string, project model.Project) (model.Project, error) {
+	sealed, err := e.encrypt(project)
+	if err != nil {
+		return project, err
+	}
+	stored, err := e.API.UpdateProject(projectName, sealed)
+	return withStored(project, sealed, stored), err
+}
+
+// SetVariable seals the value with the project's data key. A project that is not encrypted
+// yet is rewritten as a whole, so it never holds a mix of plaintext and ciphertext, and an
+// encrypted project cannot be changed without the key.
+func (e *EncryptedHandler) SetVariable(projectName string, key string, value string) error {
+	stored, err := e.API.GetProject(projectName)
+	if err != nil {
+		return err
+	}
+	if e.master == nil {
+		if stored.Encryption != nil {
+			return fmt.Errorf("%w: %s", ErrNoEncryptionKey, projectName)
+		}
+		return e.API.SetVariable(projectName, key, value)
+	}
+	if stored.Encryption == nil {
+		project, err := e.decrypt(stored)
+		if err != nil {
+			return err
+		}
+		project = cloneProject(project)
+		if project.Variables == nil {
+			project.Variables = make(map[string]string)
+		}
+		project.Variables[key] = value
+		project.TouchIn(model.DefaultEnvironment, key, time.Now())
+		_, err = e.UpdateProject(projectName, project)
+		return err
+	}
+
+	dataKey, err := e.dataKey(stored)
+	if err != nil {
+		return err
+	}
+	sealed, err := envelope.Seal(dataKey, key, value)
+	if err != nil {
+		return err
+	}
+	return e.API.SetVariable(projectName, key, sealed)
+}
+
+func (e *EncryptedHandler) GetHistory(projectName string) ([]model.Revision, error) {
+	history, err := e.API.GetHistory(projectName)
+	if err != nil {
+		return nil, err
+	}
+	for i := range history {
+		if history[i].Snapshot, err = e.decrypt(history[i].Snapshot); err != nil {
+			return nil, fmt.Errorf("revision %d: %w", history[i].Number, err)
+		}
+	}
+	return history, nil
+}
+
+func (e *EncryptedHandler) Rollback(projectName string, revision int) (model.Project, error) {
+	return e.decrypted(e.API.Rollback(projectName, revision))
+}
+
+func (e *EncryptedHandler) ListTrash() ([]model.TrashedProject, error) {
+	trash, err := e.API.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+	for i := range trash {
+		if trash[i].Project, err = e.decrypt(trash[i].Project); err != nil {
+			return nil, err
+		}
+	}
+	return trash, nil
+}
+
+func (e *EncryptedHandler) RestoreProject(projectName string) (model.Project, error) {
+	return e.decrypted(e.API.RestoreProject(projectName))
+}
+
+func (e *EncryptedHandler) RenameProject(oldName string, newName string) (model.Project, error) {
+	return e.decrypted(e.API.RenameProject(oldName, newName))
+}
+
+func (e *EncryptedHandler) decrypted(project model.Project, err error) (model.Project, error) {
+	if err != nil {
+		return project, err
+	}
+	return e.decrypt(project)
+}
+
+// decrypt returns a copy of the project with plaintext values. The encryption block is kept
+// so the same data key is used when the project is written back.
+func (e *EncryptedHandler) decrypt(project model.Project) (model.Project, error) {
+	if project.Encryption == nil {
+		return project, nil
+	}
+	dataKey, err := e.dataKey(project)
+	if err != nil {
+		return project, err
+	}
+
+	err = transformValues(&project, func(label string, key string, value string) (string, error) {
+		plaintext, err := envelope.Open(dataKey, label, value)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt %s in project %s: %w", key, project.Name, err)
+		}
+		return plaintext, nil
+	})
+	return project, err
+}
+
+// encrypt returns a copy of the project with sealed values, creating its data key on first use.
+func (e *EncryptedHandler) encrypt(project model.Project) (model.Project, error) {
+	if e.master == nil {
+		if project.Encryption != nil {
+			return project, fmt.Errorf("%w: %s", ErrNoEncryptionKey, project.Name)
+		}
+		return project, nil
+	}
+
+	var dataKey []byte
+	var err error
+	if project.Encryption == nil {
+		var encryption model.Encryption
+		dataKey, encryption, err = e.master.NewDataKey()
+		if err != nil {
+			return project, err
+		}
+		project.Encryption = &encryption
+	} else if dataKey, err = e.dataKey(project); err != nil {
+		return project, err
+	}
+
+	err = transformValues(&project, func(label string, key string, value string) (string, error) {
+		return envelope.Seal(dataKey, label, value)
+	})
+	return project, err
+}
+
+// transformValues replaces every variable value and default of the project, in all its
+// environments, with fresh maps so the original project is left untouched. transform gets
+// the label the value is bound to and the variable it belongs to.
+func transformValues(project *model.Project, transform func(label string, key string, value string) (string, error)) error {
+	transformMap := func(env string, values map[string]string) (map[string]string, error) {
+		if values == nil {
+			return nil, nil
+		}
+		result := make(map[string]string, len(values))
+		for key, value := range values {
+			var err error
+			if result[key], err = transform(valueLabel(env, key), key, value); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+	transformMeta := func(env string, metas map[string]model.VariableMeta) (map[string]model.VariableMeta, error) {
+		if metas == nil {
+			return nil, nil
+		}
+		result := make(map[string]model.VariableMeta, len(metas))
+		for key, meta := range metas {
+			if meta.Default != "" {
+				var err error
+				if meta.Default, err = transform(defaultLabel(env, key), key, meta.Default); err != nil {
+					return nil, err
+				}
+			}
+			result[key] = meta
+		}
+		return result, nil
+	}
+
+	variables, err := transformMap(model.DefaultEnvironment, project.Variables)
+	if err != nil {
+		return err
+	}
+	project.Variables = variables
+	if project.Meta, err = transformMeta(model.DefaultEnvironment, project.Meta); err != nil {
+		return err
+	}
+
+	if project.Environments == nil {
+		return nil
+	}
+	environments := make(map[string]model.Environment, len(project.Environments))
+	for name, env := range project.Environments {
+		if env.Variables, err = transformMap(name, env.Variables); err != nil {
+			return err
+		}
+		if env.Meta, err = transformMeta(name, env.Meta); err != nil {
+			return err
+		}
+		environments[name] = env
+	}
+	project.Environments = environments
+	return nil
+}
+
+// valueLabel binds a sealed value to its variable and environment, so values cannot be
+// swapped between variables or environments. Default environment values use the bare key.
+func valueLabel(env string, key string) string {
+	if env == model.DefaultEnvironment {
+		return key
+	}
+	return env + "\x00" + key
+}
+
+// defaultLabel binds a sealed default to its variable and environment, apart from the
+// variable's value so the two cannot be swapped either.
+func defaultLabel(env string, key string) string {
+	return valueLabel(env, key) + "\x00default"
+}
+
+func (e *EncryptedHandler) dataKey(project model.Project) ([]byte, error) {
+	if e.master == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoEncryptionKey, project.Name)
+	}
+	dataKey, err := e.master.Unwrap(*project.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt project %s: %w", project.Name, err)
+	}
+	return dataKey, nil
+}
+
+// withStored returns the plaintext project with the version and encryption block the backend stored.
+func withStored(project model.Project, sealed model.Project, stored model.Project) model.Project {
+	project.CAS = stored.CAS
+	project.SchemaVersion = stored.SchemaVersion
+	project.Encryption = sealed.Encryption
+	return project
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/KaiqueGovani/venom/internal/model"
+	"github.com/couchbase/gocb/v2"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// findRevision returns the numbered revision from history, refusing deletions since there is nothing to restore.
+func findRevision(history []model.Revision, projectName string, number int) (model.Revision, error) {
+	for _, revision := range history {
+		if revision.Number != number {
+			continue
+		}
+		if revision.Action == model.ActionDelete {
+			return revision, fmt.Errorf("revision %d deleted project %s; roll back to an earlier revision", number, projectName)
+		}
+		return revision, nil
+	}
+	return model.Revision{}, fmt.Errorf("%w: %d for project %s", ErrRevisionNotFound, number, projectName)
+}
+
+func rollbackDetail(number int) string {
+	return fmt.Sprintf("to revision %d", number)
+}
+
+func (a ApiHandler) GetHistory(projectName string) ([]model.Revision, error) {
+	results, err := a.Cluster.Query(
+		fmt.Sprintf("SELECT h.* FROM `%s`.`%s`.`%s` AS h WHERE h.project = $project ORDER BY h.number", a.Bucket, a.Scope, a.History),
+		&gocb.QueryOptions{
+			Adhoc:           true,
+			Readonly:        true,
+			NamedParameters: map[string]interface{}{"project": projectName},
+			// Make sure revisions written just before are included
+			ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var history []model.Revision
+	for results.Next() {
+		var revision model.Revision
+		if err := results.Row(&revision); err != nil {
+			return nil, err
+		}
+		history = append(history, revision)
+	}
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+func (a ApiHandler) Rollback(projectName string, number int) (model.Project, error) {
+	history, err := a.GetHistory(projectName)
+	if err != nil {
+		return model.Project{}, err
+	}
+	revision, err := findRevision(history, projectName, number)
+	if err != nil {
+		return model.Project{}, err
+	}
+
+	// Replace the current document with its CAS so an edit made meanwhile is a conflict. A
+	// deleted project is inserted again, which is a conflict as well if it was recreated.
+	project := stampProject(revision.Snapshot)
+	var result *gocb.MutationResult
+	current, err := a.ProjectsCollection.Get(projectName, nil)
+	deleted := errors.Is(err, gocb.ErrDocumentNotFound)
+	switch {
+	case deleted:
+		result, err = a.ProjectsCollection.Insert(projectName, project, nil)
+	case err == nil:
+		result, err = a.ProjectsCollection.Replace(projectName, project, &gocb.ReplaceOptions{Cas: current.Cas()})
+	}
+	if err != nil {
+		return project, translateError(projectName, err)
+	}
+	project.CAS = uint64(result.Cas())
+
+	if deleted {
+		// The project is live again, so its deleted copy must not be restorable
+		if _, err := a.TrashCollection.Remove(projectName, nil); err != nil && !errors.Is(err, gocb.ErrDocumentNotFound) {
+			fmt.Fprintf(os.Stderr, "Warning: project %s was rolled back but is still listed in the trash; remove it with 'venom trash purge %s': %v\n",
+				projectName, projectName, a.collectionHint(a.Trash, err))
+		}
+	}
+	return project, a.recordRevision(projectName, project, model.ActionRollback, rollbackDetail(number))
+}
+
+// recordRevision stores an immutable revision, numbered by a per-project counter document.
+// The project is already saved by then, so a revision that cannot be recorded, for instance
+// because the history collection was never created, is only a warning.
+func (a ApiHandler) recordRevision(projectName string, project model.Project, action string, detail string) error {
+	counter, err := a.HistoryCollection.Binary().Increment(projectName+"::counter", &gocb.IncrementOptions{
+		Initial: 1,
+		Delta:   1,
+	})
+	if err != nil {
+		a.warnUnrecorded(projectName, err)
+		return nil
+	}
+
+	number := int(counter.Content())
+	revision := model.Revision{
+		Number:    number,
+		Project:   projectName,
+		Action:    action,
+		Detail:    detail,
+		Author:    a.Author,
+		Timestamp: time.Now().UTC(),
+		Snapshot:  project,
+	}
+	if _, err := a.HistoryCollection.Insert(fmt.Sprintf("%s::%d", projectName, number), revision, nil); err != nil {
+		a.warnUnrecorded(projectName, err)
+	}
+	return nil
+}
+
+func (a ApiHandler) warnUnrecorded(projectName string, err error) {
+	fmt.Fprintf(os.Stderr, "Warning: project %s was saved but its revision was not recorded: %v\n", projectName, a.collectionHint(a.History, err))
+}
+
+// collectionHint points at the setup instructions when a collection venom needs is missing.
+func (a ApiHandler) collectionHint(collection string, err error) error {
+	if errors.Is(err, gocb.ErrCollectionNotFound) {
+		return fmt.Errorf("collection %s does not exist in %s.%s; see \"Couchbase setup\" in the README: %w", collection, a.Bucket, a.Scope, err)
+	}
+	return err
+}
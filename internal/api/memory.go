@@ -0,0 +1,322 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KaiqueGovani/venom/internal/model"
+)
+
+var _ API = (*MemoryHandler)(nil)
+
+// MemoryHandler keeps projects in memory. It mirrors the Couchbase handler's
+// semantics so it can stand in for it when no cluster is available.
+type MemoryHandler struct {
+	Author         string
+	TrashRetention time.Duration
+
+	mu       sync.RWMutex
+	projects map[string]model.Project
+	history  map[string][]model.Revision
+	trash    map[string]model.TrashedProject
+	lastCAS  uint64
+}
+
+func NewMemoryHandler() *MemoryHandler {
+	return &MemoryHandler{
+		projects: make(map[string]model.Project),
+		history:  make(map[string][]model.Revision),
+		trash:    make(map[string]model.TrashedProject),
+	}
+}
+
+func (m *MemoryHandler) GetProjects() (map[string]model.Project, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	projects := make(map[string]model.Project, len(m.projects))
+	for id, project := range m.projects {
+		projects[id] = cloneProject(project)
+	}
+	return projects, nil
+}
+
+func (m *MemoryHandler) GetProject(projectName string) (model.Project, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	project, ok := m.projects[projectName]
+	if !ok {
+		return model.Project{}, fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+	}
+	return cloneProject(project), nil
+}
+
+func (m *MemoryHandler) CreateProject(project model.Project) (model.Project, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.projects[project.Name]; ok {
+		return project, fmt.Errorf("%w: %s", ErrProjectExists, project.Name)
+	}
+	return m.store(project.Name, project, model.ActionCreate, ""), nil
+}
+
+func (m *MemoryHandler) UpdateProject(projectName string, project model.Project) (model.Project, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.projects[projectName]
+	if !ok {
+		return project, fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+	}
+	if project.CAS != 0 && project.CAS != current.CAS {
+		return project, &ConflictError{ProjectName: projectName}
+	}
+	return m.store(projectName, project, model.ActionUpdate, ""), nil
+}
+
+func (m *MemoryHandler) DeleteProject(projectName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	project, ok := m.projects[projectName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+	}
+	delete(m.projects, projectName)
+	m.trash[projectName] = newTrashedProject(cloneProject(project), m.Author, m.TrashRetention)
+	m.record(projectName, project, model.ActionDelete, "")
+	return nil
+}
+
+func (m *MemoryHandler) SetVariable(projectName string, key string, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	project, ok := m.projects[projectName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+	}
+	project = cloneProject(project)
+	if project.Variables == nil {
+		project.Variables = make(map[string]string)
+	}
+	project.Variables[key] = value
+	project.TouchIn(model.DefaultEnvironment, key, time.Now())
+
+	m.store(projectName, project, model.ActionUpdate, "set "+key)
+	return nil
+}
+
+func (m *MemoryHandler) UnsetVariable(projectName string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	project, ok := m.projects[projectName]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrProjectNotFound, projectName)
+	}
+	if _, ok := project.Variables[key]; !ok {
+		return fmt.Errorf("%w: %s in project %s", ErrVariableNotFound, key, projectName)
+	}
+	project = cloneProject(project)
+	delete(project.Variables, key)
+	project.TouchIn(model.DefaultEnvironment, key, time.Now())
+
+	m.store(projectName, project, model.ActionUpdate, "unset "+key)
+	return nil
+}
+
+func (m *MemoryHandler) GetHistory(projectName string) ([]model.Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	history := make([]model.Revision, len(m.history[projectName]))
+	copy(history, m.history[projectName])
+	return history, nil
+}
+
+func (m *MemoryHandler) Rollback(projectName string, number int) (model.Project, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	revision, err := findRevision(m.history[projectName], projectName, number)
+	if err != nil {
+		return model.Project{}, err
+	}
+	if _, ok := m.projects[projectName]; !ok {
+		// Bringing back a deleted project takes it out of the trash
+		delete(m.trash, projectName)
+	}
+	return m.store(projectName, revision.Snapshot, model.ActionRollback, rollbackDetail(number)), nil
+}
+
+func (m *MemoryHandler) ListTrash() ([]model.TrashedProject, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dropExpired()
+	trash := make([]model.TrashedProject, 0, len(m.trash))
+	for _, trashed := range m.trash {
+		trashed.Project = cloneProject(trashed.Project)
+		trash = append(trash, trashed)
+	}
+	sortTrash(trash)
+	return trash, nil
+}
+
+func (m *MemoryHandler) RestoreProject(projectName string) (model.Project, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dropExpired()
+	trashed, ok := m.trash[projectName]
+	if !ok {
+		return model.Project{}, fmt.Errorf("%w: %s", ErrNotInTrash, projectName)
+	}
+	if _, ok := m.projects[projectName]; ok {
+		return model.Project{}, fmt.Errorf("%w: %s", ErrProjectExists, projectName)
+	}
+	delete(m.trash, projectName)
+	return m.store(projectName, trashed.Project, model.ActionRestore, "from trash"), nil
+}
+
+func (m *MemoryHandler) PurgeTrash(projectName string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dropExpired()
+	if projectName != "" {
+		if _, ok := m.trash[projectName]; !ok {
+			return 0, fmt.Errorf("%w: %s", ErrNotInTrash, projectName)
+		}
+		delete(m.trash, projectName)
+		return 1, nil
+	}
+
+	purged := len(m.trash)
+	m.trash = make(map[string]model.TrashedProject)
+	return purged, nil
+}
+
+func (m *MemoryHandler) RenameProject(oldName string, newName string) (model.Project, error) {
+	if err := validateRename(oldName, newName); err != nil {
+		return model.Project{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	project, ok := m.projects[oldName]
+	if !ok {
+		return model.Project{}, fmt.Errorf("%w: %s", ErrProjectNotFound, oldName)
+	}
+	if _, ok := m.projects[newName]; ok {
+		return model.Project{}, fmt.Errorf("%w: %s", ErrProjectExists, newName)
+	}
+
+	delete(m.projects, oldName)
+	for _, revision := range m.history[oldName] {
+		m.history[newName] = append(m.history[newName], renamedRevision(revision, newName, len(m.history[newName])+1))
+	}
+	delete(m.history, oldName)
+
+	project.Name = newName
+	return m.store(newName, project, model.ActionRename, renameDetail(oldName)), nil
+}
+
+// MigrateSchema has nothing to do, since every project held in memory was written by this build.
+func (m *MemoryHandler) MigrateSchema() (int, error) {
+	return 0, nil
+}
+
+func (m *MemoryHandler) Close() error {
+	return nil
+}
+
+// store saves the project under a new CAS and records the change. The caller must hold the write lock.
+func (m *MemoryHandler) store(projectName string, project model.Project, action string, detail string) model.Project {
+	m.lastCAS++
+	project = stampProject(project)
+	project.CAS = m.lastCAS
+	m.projects[projectName] = cloneProject(project)
+	m.record(projectName, project, action, detail)
+	return project
+}
+
+// record appends a revision to the project's history. The caller must hold the write lock.
+func (m *MemoryHandler) record(projectName string, project model.Project, action string, detail string) {
+	m.history[projectName] = append(m.history[projectName], model.Revision{
+		Number:    len(m.history[projectName]) + 1,
+		Project:   projectName,
+		Action:    action,
+		Detail:    detail,
+		Author:    m.Author,
+		Timestamp: time.Now().UTC(),
+		Snapshot:  cloneProject(project),
+	})
+}
+
+// dropExpired forgets trashed projects past their retention. The caller must hold the write lock.
+func (m *MemoryHandler) dropExpired() {
+	now := time.Now()
+	for name, trashed := range m.trash {
+		if trashed.Expired(now) {
+			delete(m.trash, name)
+		}
+	}
+}
+
+// cloneProject copies the variables map so callers never share state with the store.
+func cloneProject(project model.Project) model.Project {
+	if project.Variables != nil {
+		variables := make(map[string]string, len(project.Variables))
+		for key, value := range project.Variables {
+			variables[key] = value
+		}
+		project.Variables = variables
+	}
+	if project.Meta != nil {
+		meta := make(map[string]model.VariableMeta, len(project.Meta))
+		for key, value := range project.Meta {
+			meta[key] = value
+		}
+		project.Meta = meta
+	}
+	project.Parents = append([]string(nil), project.Parents...)
+	if project.Schema != nil {
+		schema := make(map[string]model.Rule, len(project.Schema))
+		for key, rule := range project.Schema {
+			rule.Values = append([]string(nil), rule.Values...)
+			schema[key] = rule
+		}
+		project.Schema = schema
+	}
+	if project.Targets != nil {
+		targets := make([]model.Target, len(project.Targets))
+		for i, target := range project.Targets {
+			target.Keys = append([]string(nil), target.Keys...)
+			if target.Rename != nil {
+				rename := make(map[string]string, len(target.Rename))
+				for from, to := range target.Rename {
+					rename[from] = to
+				}
+				target.Rename = rename
+			}
+			targets[i] = target
+		}
+		project.Targets = targets
+	}
+	if project.Environments != nil {
+		environments := make(map[string]model.Environment, len(project.Environments))
+		for name, env := range project.Environments {
+			clone := cloneProject(model.Project{Variables: env.Variables, Meta: env.Meta})
+			env.Variables, env.Meta = clone.Variables, clone.Meta
+			environments[name] = env
+		}
+		project.Environments = environments
+	}
+	return project
+}
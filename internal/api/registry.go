@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/KaiqueGovani/venom/internal/config"
+)
+
+// Opener creates a ready-to-use backend. The caller owns the result and must Close it.
+type Opener func(cfg config.Config) (API, error)
+
+type backend struct {
+	open Opener
+	// remote backends are reached over the network and get the offline cache
+	remote bool
+}
+
+var (
+	openersMu sync.RWMutex
+	openers   = make(map[string]backend)
+)
+
+func init() {
+	RegisterRemote("couchbase", openCouchbase)
+	Register("memory", func(cfg config.Config) (API, error) {
+		retention, err := trashRetention(cfg)
+		if err != nil {
+			return nil, err
+		}
+		handler := NewMemoryHandler()
+		handler.Author = cfg.Author
+		handler.TrashRetention = retention
+		return handler, nil
+	})
+}
+
+// Register makes a backend available under the given name.
+// It panics if the name is empty or already registered.
+func Register(name string, opener Opener) {
+	register(name, backend{open: opener})
+}
+
+// RegisterRemote makes a network backend available under the given name. Unless the
+// offline_cache setting turns it off, its projects are cached locally so reads keep
+// working, and edits are queued for `venom sync`, while the server is unreachable.
+func RegisterRemote(name string, opener Opener) {
+	register(name, backend{open: opener, remote: true})
+}
+
+func register(name string, b backend) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	if name == "" || b.open == nil {
+		panic("api: Register called with an empty name or nil opener")
+	}
+	if _, ok := openers[name]; ok {
+		panic("api: Register called twice for backend " + name)
+	}
+	openers[name] = b
+}
+
+// Open returns the backend selected by cfg.Backend, or the default backend if it is empty,
+// with client-side encryption applied on top.
+func Open(cfg config.Config) (API, error) {
+	handler, err := open(cfg)
+	return withEncryption(cfg, handler, err)
+}
+
+func open(cfg config.Config) (API, error) {
+	name := cfg.Backend
+	if name == "" {
+		name = config.Default().Backend
+	}
+
+	openersMu.RLock()
+	b, ok := openers[name]
+	openersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(Backends(), ", "))
+	}
+
+	if !b.remote {
+		return b.open(cfg)
+	}
+	cached, err := strconv.ParseBool(cfg.OfflineCache)
+	if err != nil {
+		return nil, fmt.Errorf("invalid offline_cache value %q", cfg.OfflineCache)
+	}
+	if !cached {
+		return b.open(cfg)
+	}
+	handler, err := b.open(cfg)
+	return openCached(cfg, handler, err)
+}
+
+// Backends returns the sorted names of every registered backend.
+func Backends() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+
+	names := make([]string, 0, len(openers))
+	for name := range openers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
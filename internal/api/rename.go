@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/KaiqueGovani/venom/internal/model"
+	"github.com/couchbase/gocb/v2"
+)
+
+func validateRename(oldName string, newName string) error {
+	if newName == "" {
+		return errors.New("the new project name cannot be empty")
+	}
+	if oldName == newName {
+		return fmt.Errorf("project %s already has that name", oldName)
+	}
+	return nil
+}
+
+func renameDetail(oldName string) string {
+	return "from " + oldName
+}
+
+// renamedRevision moves a revision to the renamed project's history under a new number. Numbers
+// only change when the new name already had revisions from an earlier project.
+func renamedRevision(revision model.Revision, newName string, number int) model.Revision {
+	revision.Number = number
+	revision.Project = newName
+	revision.Snapshot.Name = newName
+	return revision
+}
+
+// RenameProject moves the project document and its history to a new key in a single
+// transaction, so readers see either the old name or the new one, never both or neither.
+func (a ApiHandler) RenameProject(oldName string, newName string) (model.Project, error) {
+	if err := validateRename(oldName, newName); err != nil {
+		return model.Project{}, err
+	}
+
+	if _, err := a.GetProject(oldName); err != nil {
+		return model.Project{}, err
+	}
+	exists, err := a.ProjectsCollection.Exists(newName, nil)
+	if err != nil {
+		return model.Project{}, err
+	}
+	if exists.Exists() {
+		return model.Project{}, fmt.Errorf("%w: %s", ErrProjectExists, newName)
+	}
+
+	history, err := a.GetHistory(oldName)
+	if err != nil {
+		return model.Project{}, err
+	}
+	// Reserve revision numbers after any left behind by an earlier project with the new name
+	base := 0
+	if len(history) > 0 {
+		counter, err := a.HistoryCollection.Binary().Increment(newName+"::counter", &gocb.IncrementOptions{
+			Initial: int64(len(history)),
+			Delta:   uint64(len(history)),
+		})
+		if err != nil {
+			return model.Project{}, err
+		}
+		base = int(counter.Content()) - len(history)
+	}
+
+	var project model.Project
+	_, err = a.Cluster.Transactions().Run(func(ctx *gocb.TransactionAttemptContext) error {
+		current, err := ctx.Get(a.ProjectsCollection, oldName)
+		if err != nil {
+			return err
+		}
+		var document json.RawMessage
+		if err := current.Content(&document); err != nil {
+			return err
+		}
+		project, err = decodeDocument(oldName, document)
+		if err != nil {
+			return err
+		}
+		project.Name = newName
+		project = stampProject(project)
+
+		if _, err := ctx.Insert(a.ProjectsCollection, newName, project); err != nil {
+			return err
+		}
+		if err := ctx.Remove(current); err != nil {
+			return err
+		}
+
+		for i, revision := range history {
+			stored, err := ctx.Get(a.HistoryCollection, fmt.Sprintf("%s::%d", oldName, revision.Number))
+			if err != nil {
+				return err
+			}
+			revision = renamedRevision(revision, newName, base+i+1)
+			if _, err := ctx.Insert(a.HistoryCollection, fmt.Sprintf("%s::%d", newName, revision.Number), revision); err != nil {
+				return err
+			}
+			if err := ctx.Remove(stored); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+	switch {
+	case errors.Is(err, gocb.ErrDocumentExists):
+		return model.Project{}, fmt.Errorf("%w: %s", ErrProjectExists, newName)
+	case errors.Is(err, gocb.ErrDocumentNotFound):
+		return model.Project{}, fmt.Errorf("%w: %s", ErrProjectNotFound, oldName)
+	case err != nil:
+		return model.Project{}, fmt.Errorf("failed to rename project %s: %w", oldName, err)
+	}
+
+	// The old counter is no longer referenced; a leftover one only wastes a document
+	a.HistoryCollection.Remove(oldName+"::counter", nil)
+
+	renamed, err := a.GetProject(newName)
+	if err != nil {
+		return project, err
+	}
+	return renamed, a.recordRevision(newName, renamed, model.ActionRename, renameDetail(oldName))
+}
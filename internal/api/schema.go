@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/KaiqueGovani/venom/internal/model"
+	"github.com/couchbase/gocb/v2"
+)
+
+var ErrSchemaTooNew = errors.New("project was written by a newer version of venom")
+
+// schemaMigrations upgrade a raw project document by one version each: the migration at
+// index i turns a version i document into a version i+1 one. Append to this list, and bump
+// model.CurrentSchemaVersion, whenever the stored layout changes.
+var schemaMigrations = []func(document map[string]any) error{
+	// 0 → 1: documents from before versioning may store null variables
+	func(document map[string]any) error {
+		if document["variables"] == nil {
+			document["variables"] = map[string]any{}
+		}
+		return nil
+	},
+	// 1 → 2: projects may carry fields that version 1 builds do not know: an encryption block
+	// with encrypted values, variable metadata, a file mode, environments, output targets,
+	// validation rules and parents. Nothing to convert, but an older build would read the
+	// encrypted values as plaintext and drop the rest on write, so it must refuse these documents
+	func(document map[string]any) error {
+		return nil
+	},
+}
+
+// decodeDocument reads a stored project, running the migrations it is missing first.
+func decodeDocument(projectName string, data []byte) (model.Project, error) {
+	var project model.Project
+
+	var document map[string]any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return project, fmt.Errorf("failed to decode project %s: %w", projectName, err)
+	}
+
+	version, err := documentVersion(document)
+	if err != nil {
+		return project, fmt.Errorf("failed to decode project %s: %w", projectName, err)
+	}
+	if version > model.CurrentSchemaVersion {
+		return project, fmt.Errorf("%w: %s has schema version %d, this build supports up to %d", ErrSchemaTooNew, projectName, version, model.CurrentSchemaVersion)
+	}
+
+	if version < model.CurrentSchemaVersion {
+		for _, migrate := range schemaMigrations[version:] {
+			if err := migrate(document); err != nil {
+				return project, fmt.Errorf("failed to upgrade project %s from schema version %d: %w", projectName, version, err)
+			}
+		}
+		document["schema_version"] = model.CurrentSchemaVersion
+		if data, err = json.Marshal(document); err != nil {
+			return project, err
+		}
+	}
+
+	if err := json.Unmarshal(data, &project); err != nil {
+		return project, fmt.Errorf("failed to decode project %s: %w", projectName, err)
+	}
+	return project, nil
+}
+
+// documentVersion returns the schema version of a raw document, zero when it has none.
+func documentVersion(document map[string]any) (int, error) {
+	switch version := document["schema_version"].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		if version < 0 || version != float64(int(version)) {
+			return 0, fmt.Errorf("invalid schema version %v", version)
+		}
+		return int(version), nil
+	default:
+		return 0, fmt.Errorf("invalid schema version %v", version)
+	}
+}
+
+// stampProject marks a project with the current schema version before it is written.
+func stampProject(project model.Project) model.Project {
+	project.SchemaVersion = model.CurrentSchemaVersion
+	if project.Variables == nil {
+		project.Variables = make(map[string]string)
+	}
+	return project
+}
+
+// MigrateSchema rewrites every project stored with an older schema version. Each document is
+// replaced with the CAS it was read with, so a concurrent edit is reported as a conflict instead
+// of being overwritten; running the command again picks up whatever is left.
+func (a ApiHandler) MigrateSchema() (int, error) {
+	results, err := a.Cluster.Query(
+		fmt.Sprintf("SELECT RAW META(p).id FROM `%s`.`%s`.`%s` AS p WHERE IFMISSINGORNULL(p.schema_version, 0) < $version", a.Bucket, a.Scope, a.Collection),
+		&gocb.QueryOptions{
+			Adhoc:           true,
+			Readonly:        true,
+			NamedParameters: map[string]interface{}{"version": model.CurrentSchemaVersion},
+			ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+		})
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []string
+	for results.Next() {
+		var id string
+		if err := results.Row(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err := results.Err(); err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, id := range ids {
+		project, err := a.GetProject(id)
+		if errors.Is(err, ErrProjectNotFound) {
+			continue
+		}
+		if err != nil {
+			return migrated, err
+		}
+		_, err = a.ProjectsCollection.Replace(id, stampProject(project), &gocb.ReplaceOptions{
+			Cas: gocb.Cas(project.CAS),
+		})
+		if err != nil {
+			return migrated, translateError(id, err)
+		}
+		migrated++
+	}
+	return migrated, nil
+}
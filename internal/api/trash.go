@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/KaiqueGovani/venom/internal/config"
+	"github.com/KaiqueGovani/venom/internal/model"
+	"github.com/couchbase/gocb/v2"
+)
+
+var ErrNotInTrash = errors.New("project not found in trash")
+
+// trashRetention parses the configured retention. Zero keeps trashed projects until purged.
+func trashRetention(cfg config.Config) (time.Duration, error) {
+	if cfg.TrashRetention == "" {
+		return 0, nil
+	}
+	retention, err := time.ParseDuration(cfg.TrashRetention)
+	if err != nil || retention < 0 {
+		return 0, fmt.Errorf("invalid trash_retention value %q", cfg.TrashRetention)
+	}
+	return retention, nil
+}
+
+func newTrashedProject(project model.Project, author string, retention time.Duration) model.TrashedProject {
+	now := time.Now().UTC()
+	trashed := model.TrashedProject{
+		Project:   project,
+		DeletedBy: author,
+		DeletedAt: now,
+	}
+	if retention > 0 {
+		trashed.ExpiresAt = now.Add(retention)
+	}
+	return trashed
+}
+
+// sortTrash orders trashed projects from the most recently deleted.
+func sortTrash(trash []model.TrashedProject) {
+	sort.Slice(trash, func(i, j int) bool {
+		return trash[i].DeletedAt.After(trash[j].DeletedAt)
+	})
+}
+
+func (a ApiHandler) ListTrash() ([]model.TrashedProject, error) {
+	results, err := a.Cluster.Query(
+		fmt.Sprintf("SELECT t.* FROM `%s`.`%s`.`%s` AS t", a.Bucket, a.Scope, a.Trash),
+		&gocb.QueryOptions{
+			Adhoc:           true,
+			Readonly:        true,
+			ScanConsistency: gocb.QueryScanConsistencyRequestPlus,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var trash []model.TrashedProject
+	now := time.Now()
+	for results.Next() {
+		var trashed model.TrashedProject
+		if err := results.Row(&trashed); err != nil {
+			return nil, err
+		}
+		// Expired documents may still be returned until the server removes them
+		if !trashed.Expired(now) {
+			trash = append(trash, trashed)
+		}
+	}
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+
+	sortTrash(trash)
+	return trash, nil
+}
+
+func (a ApiHandler) RestoreProject(projectName string) (model.Project, error) {
+	result, err := a.TrashCollection.Get(projectName, nil)
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return model.Project{}, fmt.Errorf("%w: %s", ErrNotInTrash, projectName)
+	}
+	if err != nil {
+		return model.Project{}, err
+	}
+	var trashed model.TrashedProject
+	if err := result.Content(&trashed); err != nil {
+		return model.Project{}, err
+	}
+
+	project := stampProject(trashed.Project)
+	inserted, err := a.ProjectsCollection.Insert(projectName, project, nil)
+	if err != nil {
+		return project, translateError(projectName, err)
+	}
+	project.CAS = uint64(inserted.Cas())
+
+	if _, err := a.TrashCollection.Remove(projectName, &gocb.RemoveOptions{Cas: result.Cas()}); err != nil {
+		return project, fmt.Errorf("project %s was restored but could not be removed from the trash: %w", projectName, err)
+	}
+	return project, a.recordRevision(projectName, project, model.ActionRestore, "from trash")
+}
+
+// PurgeTrash permanently removes a project from the trash, or every trashed project when projectName is empty.
+func (a ApiHandler) PurgeTrash(projectName string) (int, error) {
+	if projectName != "" {
+		_, err := a.TrashCollection.Remove(projectName, nil)
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			return 0, fmt.Errorf("%w: %s", ErrNotInTrash, projectName)
+		}
+		if err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	trash, err := a.ListTrash()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, trashed := range trash {
+		_, err := a.TrashCollection.Remove(trashed.Project.Name, nil)
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/KaiqueGovani/venom/internal/model"
+)
+
+// SetVariableIn sets a variable in an environment of a project. The default environment uses
+// the backend's SetVariable; a named one is saved with a whole-project update, which creates
+// the environment when it is missing.
+func SetVariableIn(a API, projectName string, env string, key string, value string) error {
+	if env == model.DefaultEnvironment {
+		return a.SetVariable(projectName, key, value)
+	}
+	return updateProject(a, projectName, func(project *model.Project) error {
+		if err := checkNewEnvironment(*project, env); err != nil {
+			return err
+		}
+		project.SetVariableIn(env, key, value)
+		return nil
+	})
+}
+
+// UnsetVariableIn removes a variable from an environment of a project.
+func UnsetVariableIn(a API, projectName string, env string, key string) error {
+	if env == model.DefaultEnvironment {
+		return a.UnsetVariable(projectName, key)
+	}
+	return updateProject(a, projectName, func(project *model.Project) error {
+		if !project.HasEnvironment(env) {
+			return fmt.Errorf("%w: %s in project %s", ErrEnvironmentNotFound, env, projectName)
+		}
+		if !project.UnsetVariableIn(env, key) {
+			return fmt.Errorf("%w: %s in project %s", ErrVariableNotFound, key, projectName)
+		}
+		return nil
+	})
+}
+
+// SetSecretVariable sets a variable together with its secret flag in one project update,
+// so the value is never stored without its flag.
+func SetSecretVariable(a API, projectName string, env string, key string, value string, secret bool) error {
+	return updateProject(a, projectName, func(project *model.Project) error {
+		if err := checkNewEnvironment(*project, env); err != nil {
+			return err
+		}
+		project.SetVariableIn(env, key, value)
+		project.SetSecretIn(env, key, secret)
+		return nil
+	})
+}
+
+// UpdateVariableMeta applies edit to the metadata of a variable of an environment. The
+// variable does not need to be set, so it can be documented, or given a default, up front.
+func UpdateVariableMeta(a API, projectName string, env string, key string, edit func(meta *model.VariableMeta)) error {
+	return updateProject(a, projectName, func(project *model.Project) error {
+		if err := checkNewEnvironment(*project, env); err != nil {
+			return err
+		}
+		project.EditMetaIn(env, key, edit)
+		return nil
+	})
+}
+
+// SetRule sets the validation rule of a variable in all environments of a project, or
+// removes it when rule is nil.
+func SetRule(a API, projectName string, key string, rule *model.Rule) error {
+	return updateProject(a, projectName, func(project *model.Project) error {
+		if rule == nil {
+			if _, ok := project.Schema[key]; !ok {
+				return fmt.Errorf("%w: %s in project %s", ErrRuleNotFound, key, projectName)
+			}
+			delete(project.Schema, key)
+			return nil
+		}
+		if project.Schema == nil {
+			project.Schema = make(map[string]model.Rule)
+		}
+		project.Schema[key] = *rule
+		return nil
+	})
+}
+
+// SetParents sets the projects a project inherits from, refusing parents that do not exist
+// or that inherit from the project themselves.
+func SetParents(a API, projectName string, parents []string) error {
+	return updateProject(a, projectName, func(project *model.Project) error {
+		project.Parents = parents
+		_, _, err := project.Inherited(model.DefaultEnvironment, a.GetProject)
+		return err
+	})
+}
+
+// updateProject applies change to the latest version of a project and saves it, recording
+// when the variables it changes were modified. Like UpdateProject, it fails with a
+// ConflictError if someone else modifies the project in between.
+func updateProject(a API, projectName string, change func(project *model.Project) error) error {
+	current, err := a.GetProject(projectName)
+	if err != nil {
+		return err
+	}
+	project := cloneProject(current)
+	if err := change(&project); err != nil {
+		return err
+	}
+	touchChanged(current, &project, time.Now())
+
+	_, err = a.UpdateProject(projectName, project)
+	return err
+}
+
+// touchChanged records the modification time of every variable, in any environment, that was
+// added, changed or removed between two versions of a project.
+func touchChanged(before model.Project, after *model.Project, now time.Time) {
+	environments := append([]string{model.DefaultEnvironment}, after.EnvironmentNames()...)
+	for _, env := range environments {
+		var previous map[string]string
+		if before.HasEnvironment(env) {
+			previous = before.InEnvironment(env).Variables
+		}
+		current := after.InEnvironment(env).Variables
+
+		var changed []string
+		for key, value := range current {
+			if old, ok := previous[key]; !ok || old != value {
+				changed = append(changed, key)
+			}
+		}
+		for key := range previous {
+			if _, ok := current[key]; !ok {
+				changed = append(changed, key)
+			}
+		}
+		for _, key := range changed {
+			after.TouchIn(env, key, now)
+		}
+	}
+}
+
+// checkNewEnvironment validates the name of an environment that is about to be created.
+func checkNewEnvironment(project model.Project, env string) error {
+	if project.HasEnvironment(env) {
+		return nil
+	}
+	return model.ValidateEnvironmentName(env)
+}
@@ -1,15 +1,19 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/KaiqueGovani/venom/internal/api"
-	"github.com/KaiqueGovani/venom/internal/db"
+	"github.com/KaiqueGovani/venom/internal/config"
 	"github.com/KaiqueGovani/venom/internal/fs"
 	mod "github.com/KaiqueGovani/venom/internal/model"
+	"github.com/KaiqueGovani/venom/internal/secret"
+	"github.com/KaiqueGovani/venom/internal/validation"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/table"
@@ -17,13 +21,6 @@ import (
 	"github.com/charmbracelet/huh"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/common-nighthawk/go-figure"
-	"github.com/couchbase/gocb/v2"
-)
-
-const (
-	bucketName     = "venom"
-	scopeName      = "mindsnap"
-	collectionName = "projects"
 )
 
 // #region Styles
@@ -92,6 +89,7 @@ const (
 	Confirm
 	CreateVariableForm
 	EditVariableForm
+	TrashList
 )
 
 // #region Model
@@ -105,25 +103,41 @@ type model struct {
 	selectedProject *mod.Project
 	form            *huh.Form
 	spinner         spinner.Model
-	apiHandler      *api.ApiHandler
-	cluster         *gocb.Cluster
+	apiHandler      api.API
+	config          config.Config
 	previousState   State
 	confirmCallback tea.Cmd
 	fs              fs.FileSystem
+	trashTable      table.Model
+	trash           []mod.TrashedProject
+	notice          string
+	secrets         secret.Policy
+	// revealed is the secret variable shown in clear until the selection moves or revealID
+	// expires, and revealAll shows every secret value
+	revealed  string
+	revealID  int
+	revealAll bool
+	// environment is the environment of the selected project shown in the variables table
+	environment string
 }
 
 // #region KeyMap
 type CustomKeyMap struct {
-	LineUp    key.Binding
-	LineDown  key.Binding
-	Configure key.Binding
-	Edit      key.Binding
-	Delete    key.Binding
-	Create    key.Binding
-	Quit      key.Binding
-	Help      key.Binding
-	Save      key.Binding
-	Pull      key.Binding
+	LineUp      key.Binding
+	LineDown    key.Binding
+	Configure   key.Binding
+	Edit        key.Binding
+	Delete      key.Binding
+	Create      key.Binding
+	Quit        key.Binding
+	Help        key.Binding
+	Save        key.Binding
+	Pull        key.Binding
+	Trash       key.Binding
+	Restore     key.Binding
+	Reveal      key.Binding
+	RevealAll   key.Binding
+	Environment key.Binding
 }
 
 func (k CustomKeyMap) FullHelp() [][]key.Binding {
@@ -135,7 +149,7 @@ func (k CustomKeyMap) FullHelp() [][]key.Binding {
 }
 
 func (k CustomKeyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.LineUp, k.LineDown, k.Pull, k.Create, k.Edit, k.Configure, k.Delete, k.Quit}
+	return []key.Binding{k.LineUp, k.LineDown, k.Pull, k.Create, k.Edit, k.Configure, k.Restore, k.Delete, k.Trash, k.Reveal, k.RevealAll, k.Environment, k.Quit}
 }
 
 var customKeyMap = CustomKeyMap{
@@ -179,6 +193,30 @@ var customKeyMap = CustomKeyMap{
 		key.WithKeys("s"),
 		key.WithHelp("✅ s", "\bave"),
 	),
+	Trash: key.NewBinding(
+		key.WithKeys("t"),
+		key.WithHelp("🗑 t", "\brash"),
+	),
+	Restore: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("♻ r", "\bestore"),
+		key.WithDisabled(),
+	),
+	Reveal: key.NewBinding(
+		key.WithKeys("x"),
+		key.WithHelp("👁 x", "\beveal"),
+		key.WithDisabled(),
+	),
+	RevealAll: key.NewBinding(
+		key.WithKeys("X"),
+		key.WithHelp("👀 X", "\beveal all"),
+		key.WithDisabled(),
+	),
+	Environment: key.NewBinding(
+		key.WithKeys("n"),
+		key.WithHelp("🌎 n", "\bext env"),
+		key.WithDisabled(),
+	),
 }
 
 // #region ProjectsTable
@@ -231,10 +269,27 @@ func createProjectForm(project *mod.Project, new bool) *huh.Form {
 
 	if new {
 		fields = append(fields, huh.NewInput().Key("Name").Title("Project Name").Value(&project.Name))
+	} else {
+		// Bind a copy so the selected project keeps its current name until the rename is saved
+		name := project.Name
+		fields = append(fields, huh.NewInput().Key("Name").Title("Project Name").Value(&name).
+			Validate(func(s string) error {
+				if strings.TrimSpace(s) == "" {
+					return errors.New("project name cannot be empty")
+				}
+				return nil
+			}))
 	}
 
-	fields = append(fields, huh.NewInput().Key("Folder").Title("Target Folder").Value(&project.TargetFolder))
-	fields = append(fields, huh.NewInput().Key("File").Title("File Name").Value(&project.FileName))
+	fields = append(fields, huh.NewInput().Key("Folder").Title("Target Folder").Value(&project.TargetFolder).
+		Validate(fs.ValidateTargetFolder))
+	fields = append(fields, huh.NewInput().Key("File").Title("File Name").Value(&project.FileName).
+		Validate(fs.ValidateFileName))
+	fields = append(fields, huh.NewInput().Key("Mode").Title("File Mode").Placeholder("0600").Value(&project.FileMode).
+		Validate(func(s string) error {
+			_, err := fs.ParseFileMode(strings.TrimSpace(s))
+			return err
+		}))
 	fields = append(fields, huh.NewConfirm().Key("confirm").Title("Confirm Changes").Affirmative("Yes").Negative("No"))
 
 	form := huh.NewForm(
@@ -245,6 +300,13 @@ func createProjectForm(project *mod.Project, new bool) *huh.Form {
 }
 
 // #region VariablesTable
+const (
+	secretPlaceholder = secret.Placeholder
+	notSetPlaceholder = "(not set)"
+	// revealDuration is how long a revealed secret value stays in clear
+	revealDuration = 5 * time.Second
+)
+
 // Helper function to display the variables table
 func (m *model) showVariablesTable() tea.Cmd {
 	// Set the state to VariablesForm
@@ -253,7 +315,13 @@ func (m *model) showVariablesTable() tea.Cmd {
 	// Disable the help for variable key
 	m.customKeyMap.Configure.SetEnabled(false)
 	m.customKeyMap.Pull.SetEnabled(false)
+	m.customKeyMap.Trash.SetEnabled(false)
+	m.customKeyMap.Reveal.SetEnabled(true)
+	m.customKeyMap.RevealAll.SetEnabled(true)
+	m.customKeyMap.Environment.SetEnabled(len(m.selectedProject.Environments) > 0)
 
+	m.revealed = ""
+	m.environment = mod.DefaultEnvironment
 	m.updateVariablesTable()
 
 	return nil
@@ -262,8 +330,10 @@ func (m *model) showVariablesTable() tea.Cmd {
 func createVariablesTable() table.Model {
 	// Define the columns for the variables table
 	columns := []table.Column{
-		{Title: "Key", Width: 50},
-		{Title: "Value", Width: 50},
+		{Title: "Key", Width: 32},
+		{Title: "Value", Width: 44},
+		{Title: "Secret", Width: 8},
+		{Title: "Source", Width: 24},
 	}
 
 	// Create the table
@@ -277,30 +347,229 @@ func createVariablesTable() table.Model {
 }
 
 func (m *model) updateVariablesTable() {
-	// Create a sorted slice of keys
-	var keys []string
-	for key := range m.selectedProject.Variables {
-		keys = append(keys, key)
+	m.renderVariableRows()
+	m.varTable.GotoTop()
+}
+
+// environmentView returns the selected project as seen from the current environment, with
+// the variables it inherits. If its parents cannot be resolved, only its own are shown.
+func (m *model) environmentView() mod.Project {
+	view, _, _ := m.inherited()
+	return view
+}
+
+// inherited resolves the current environment of the selected project with its parents,
+// read from the loaded projects.
+func (m model) inherited() (mod.Project, mod.Inheritance, error) {
+	view, inheritance, err := m.selectedProject.Inherited(m.environment, m.lookupProject)
+	if err != nil {
+		return m.selectedProject.InEnvironment(m.environment), inheritance, err
+	}
+	return view, inheritance, nil
+}
+
+// lookupProject reads a parent project from the loaded projects.
+func (m model) lookupProject(name string) (mod.Project, error) {
+	project, ok := m.projects[name]
+	if !ok {
+		return project, fmt.Errorf("%w: %s", api.ErrProjectNotFound, name)
 	}
-	sort.Strings(keys)
+	return project, nil
+}
 
-	// Create the table rows using the sorted keys
+// nextEnvironment switches the variables table to the following environment, after the
+// named ones wrapping around to the project's own variables.
+func (m *model) nextEnvironment() {
+	environments := append([]string{mod.DefaultEnvironment}, m.selectedProject.EnvironmentNames()...)
+	next := 0
+	for i, env := range environments {
+		if env == m.environment {
+			next = (i + 1) % len(environments)
+		}
+	}
+	m.environment = environments[next]
+	m.revealed = ""
+	m.updateVariablesTable()
+}
+
+// renderVariableRows fills the variables table, masking secret values that are not revealed
+// and telling inherited and overridden values apart.
+func (m *model) renderVariableRows() {
+	project, inheritance, _ := m.inherited()
+
+	// Create the table rows using the sorted keys, including variables only declared by their metadata
 	var variableRows []table.Row
-	for _, key := range keys {
-		value := m.selectedProject.Variables[key]
-		variableRows = append(variableRows, table.Row{key, value})
+	for _, key := range project.VariableNames() {
+		value, set := project.Variables[key]
+		if !set {
+			value = notSetPlaceholder
+		}
+		secret := ""
+		if m.secrets.IsSecret(project, key) {
+			secret = "yes"
+			if set && !m.revealAll && key != m.revealed {
+				value = secretPlaceholder
+			}
+		}
+		source := ""
+		if from, ok := inheritance.From[key]; ok {
+			source = "from " + from
+		} else if from, ok := inheritance.Overrides[key]; ok {
+			source = "overrides " + from
+		}
+		variableRows = append(variableRows, table.Row{key, value, secret, source})
 	}
 
 	m.varTable.SetRows(variableRows)
-	m.varTable.GotoTop()
+}
+
+// variableDetails describes the metadata and rule of the selected variable, or returns an empty
+// string when it has none.
+func (m model) variableDetails() string {
+	if len(m.varTable.Rows()) == 0 {
+		return ""
+	}
+	project, inheritance, _ := m.inherited()
+	key := m.varTable.SelectedRow()[0]
+	meta := project.Meta[key]
+
+	label := lipgloss.NewStyle().Bold(true).Foreground(purple)
+	text := lipgloss.NewStyle().Foreground(white)
+	var lines []string
+	add := func(name string, value string) {
+		lines = append(lines, label.Render(name+": ")+text.Render(value))
+	}
+	if from, ok := inheritance.From[key]; ok {
+		add("Inherited from", from)
+	} else if from, ok := inheritance.Overrides[key]; ok {
+		add("Overrides", from)
+	}
+	if meta.Description != "" {
+		add("Description", meta.Description)
+	}
+	if meta.Owner != "" {
+		add("Owner", meta.Owner)
+	}
+	if meta.Default != "" {
+		value := meta.Default
+		if m.secrets.IsSecret(project, key) && !m.revealAll && key != m.revealed {
+			value = secretPlaceholder
+		}
+		add("Default", value)
+	}
+	if meta.Required {
+		add("Required", "yes")
+	}
+	if meta.Modified != nil {
+		add("Modified", meta.Modified.Local().Format("2006-01-02 15:04"))
+	}
+	if rule, ok := project.Schema[key]; ok {
+		add("Rule", validation.Describe(rule))
+		if value, set := project.Variables[key]; set {
+			if err := validation.Value(rule, value); err != nil {
+				add("Invalid", err.Error())
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return baseStyle.Render(strings.Join(lines, "\n"))
+}
+
+// revealSelected shows the selected variable in clear for revealDuration.
+func (m *model) revealSelected() tea.Cmd {
+	m.revealed = m.varTable.SelectedRow()[0]
+	m.revealID++
+	m.renderVariableRows()
+
+	id := m.revealID
+	return tea.Tick(revealDuration, func(time.Time) tea.Msg {
+		return HideRevealed{ID: id}
+	})
+}
+
+// hideRevealed masks the revealed variable again.
+func (m *model) hideRevealed() {
+	if m.revealed == "" {
+		return
+	}
+	m.revealed = ""
+	if m.state == VariablesList {
+		m.renderVariableRows()
+	}
+}
+
+// #region TrashTable
+func (m *model) showTrashTable() tea.Cmd {
+	// Only navigation, restore and purge make sense for deleted projects
+	m.customKeyMap.Pull.SetEnabled(false)
+	m.customKeyMap.Create.SetEnabled(false)
+	m.customKeyMap.Edit.SetEnabled(false)
+	m.customKeyMap.Configure.SetEnabled(false)
+	m.customKeyMap.Trash.SetEnabled(false)
+	m.customKeyMap.Restore.SetEnabled(true)
+	m.notice = ""
+
+	return tea.Sequence(m.SetLoading(), m.GetTrash())
+}
+
+func createTrashTable() table.Model {
+	columns := []table.Column{
+		{Title: "Project", Width: 30},
+		{Title: "Deleted", Width: 16},
+		{Title: "By", Width: 15},
+		{Title: "Expires", Width: 16},
+		{Title: "Vars", Width: 4},
+	}
+
+	t := table.New(
+		table.WithColumns(columns),
+		table.WithFocused(true),
+		table.WithHeight(6),
+	)
+	styleTable(&t)
+	return t
+}
+
+func (m *model) updateTrashTable() {
+	const timeFormat = "2006-01-02 15:04"
+
+	var trashRows []table.Row
+	for _, trashed := range m.trash {
+		expires := "never"
+		if !trashed.ExpiresAt.IsZero() {
+			expires = trashed.ExpiresAt.Local().Format(timeFormat)
+		}
+		trashRows = append(trashRows, table.Row{
+			trashed.Project.Name,
+			trashed.DeletedAt.Local().Format(timeFormat),
+			trashed.DeletedBy,
+			expires,
+			fmt.Sprintf("%d", len(trashed.Project.Variables)),
+		})
+	}
+
+	m.trashTable.SetRows(trashRows)
+	m.trashTable.GotoTop()
 }
 
 // #region VariableForm
-func createVariableForm(key, value string) *huh.Form {
+func createVariableForm(key, value string, secret bool, project mod.Project) *huh.Form {
+	// The key input updates key as it is typed, so the value is checked against the rule of the key entered
+	valueInput := huh.NewInput().Key("value").Title("Variable Value").Value(&value).
+		Validate(func(s string) error {
+			return validation.Variable(project, key, s)
+		})
+	if secret {
+		valueInput.EchoMode(huh.EchoModePassword)
+	}
+
 	form := huh.NewForm(
 		huh.NewGroup(
 			huh.NewInput().Key("key").Title("Variable Key").Value(&key),
-			huh.NewInput().Key("value").Title("Variable Value").Value(&value),
+			valueInput,
+			huh.NewConfirm().Key("secret").Title("Secret").Affirmative("Yes").Negative("No").Value(&secret),
 			huh.NewConfirm().Key("confirm").Title("Add Variable").Affirmative("Yes").Negative("No"),
 		),
 	).WithWidth(45).WithTheme(getBaseTheme())
@@ -332,6 +601,20 @@ func createConfirmForm(customMessage ...string) *huh.Form {
 type Message struct{}
 type GoToProjectsList struct{}
 
+// HideRevealed is sent when a revealed secret value should be masked again.
+type HideRevealed struct {
+	ID int
+}
+
+// ProjectConflict is sent when a save fails because someone else changed the project meanwhile.
+type ProjectConflict struct {
+	Latest mod.Project
+	// Retry applies the change again on top of Latest.
+	Retry tea.Cmd
+	// Back is the state to return to when the change is dropped.
+	Back State
+}
+
 func (m *model) SetLoading() tea.Cmd {
 	m.state = Loading
 	return m.spinner.Tick
@@ -347,30 +630,39 @@ func (m *model) showConfirmForm(callback tea.Cmd, previousState State, message .
 
 func (m *model) GetApiHandler() tea.Cmd {
 	return func() tea.Msg {
-		cluster, err := db.Connect()
+		apiHandler, err := api.Open(m.config)
 		if err != nil {
 			panic(err)
 		}
-		m.cluster = cluster
-
-		// Get the bucket
-		bucket := m.cluster.Bucket(bucketName)
-		bucket.WaitUntilReady(5*time.Second, nil)
-
-		// Get the collection
-		col := cluster.Bucket(bucketName).Scope(scopeName).Collection(collectionName)
-
-		m.apiHandler = api.NewApiHandler(bucketName, scopeName, collectionName, cluster, col)
+		m.apiHandler = apiHandler
+		// History and trash live only on the server
+		m.customKeyMap.Trash.SetEnabled(!m.offline())
 		return Message{}
 	}
 
 }
 
+// offline reports whether the backend is serving cached projects because the server is unreachable.
+func (m *model) offline() bool {
+	cached, ok := api.AsCached(m.apiHandler)
+	return ok && cached.Offline()
+}
+
 // #region ProjectCommands
 func (m *model) GetProjects() tea.Cmd {
 	return func() tea.Msg {
 		// Get all projects
-		projects, _ := m.apiHandler.GetProjects()
+		projects, err := m.apiHandler.GetProjects()
+		var unreadable *api.UnreadableError
+		switch {
+		case errors.As(err, &unreadable):
+			m.notice = fmt.Sprintf("Skipped projects that cannot be decrypted: %v", err)
+		case err != nil:
+			m.notice = fmt.Sprintf("Failed to load projects: %v", err)
+			if projects = m.projects; projects == nil {
+				projects = make(map[string]mod.Project)
+			}
+		}
 
 		m.projects = projects
 		m.updateProjectsTable()
@@ -380,23 +672,36 @@ func (m *model) GetProjects() tea.Cmd {
 
 func (m *model) CreateProject() tea.Cmd {
 	return func() tea.Msg {
-		name, err := m.apiHandler.CreateProject(*m.selectedProject)
+		project, err := m.apiHandler.CreateProject(*m.selectedProject)
 		if err != nil {
 			panic(err)
 		}
-		m.projects[name] = *m.selectedProject
+		m.projects[project.Name] = project
 		return GoToProjectsList{}
 	}
 }
 
-func (m *model) UpdateProject() tea.Cmd {
+func (m *model) UpdateProject(change func(*mod.Project)) tea.Cmd {
+	return m.saveChange(change)
+}
+
+// RenameProject moves the selected project to a new name and then saves the rest of the edit form.
+func (m *model) RenameProject(newName string, change func(*mod.Project)) tea.Cmd {
 	return func() tea.Msg {
-		project, err := m.apiHandler.UpdateProject(m.selectedProject.Name, *m.selectedProject)
+		oldName := m.selectedProject.Name
+		project, err := m.apiHandler.RenameProject(oldName, newName)
+		if errors.Is(err, api.ErrProjectExists) {
+			m.notice = fmt.Sprintf("A project named '%s' already exists.", newName)
+			return GoToProjectsList{}
+		}
 		if err != nil {
 			panic(err)
 		}
+		delete(m.projects, oldName)
 		m.projects[project.Name] = project
-		return GoToProjectsList{}
+		*m.selectedProject = project
+
+		return m.saveChange(change)()
 	}
 }
 
@@ -412,10 +717,54 @@ func (m *model) DeleteProject() tea.Cmd {
 	}
 }
 
+// #region TrashCommands
+func (m *model) GetTrash() tea.Cmd {
+	return func() tea.Msg {
+		trash, err := m.apiHandler.ListTrash()
+		if err != nil {
+			panic(err)
+		}
+		m.trash = trash
+		m.updateTrashTable()
+		m.state = TrashList
+		return Message{}
+	}
+}
+
+func (m *model) RestoreProject(projectName string) tea.Cmd {
+	return func() tea.Msg {
+		project, err := m.apiHandler.RestoreProject(projectName)
+		if errors.Is(err, api.ErrProjectExists) {
+			// Keep the user in the trash so they can rename or delete the live project first
+			m.notice = fmt.Sprintf("A project named '%s' already exists.", projectName)
+			m.state = TrashList
+			return Message{}
+		}
+		if err != nil {
+			panic(err)
+		}
+		m.projects[project.Name] = project
+		return GoToProjectsList{}
+	}
+}
+
+func (m *model) PurgeProject(projectName string) tea.Cmd {
+	return func() tea.Msg {
+		if _, err := m.apiHandler.PurgeTrash(projectName); err != nil {
+			panic(err)
+		}
+		return m.GetTrash()()
+	}
+}
+
 // #region VariablesCommands
 func (m *model) PullVariables() tea.Cmd {
 	return func() tea.Msg {
-		err := m.fs.SaveVariables([]mod.Project{*m.selectedProject})
+		project, _, err := m.selectedProject.Inherited(mod.DefaultEnvironment, m.lookupProject)
+		if err != nil {
+			panic(err)
+		}
+		err = m.fs.SaveVariables([]mod.Project{project})
 		if err != nil {
 			panic(err)
 		}
@@ -423,24 +772,119 @@ func (m *model) PullVariables() tea.Cmd {
 	}
 }
 
-func (m *model) SaveVariables() tea.Cmd {
+// SaveVariable stores a variable, flagging it explicitly only when the secret choice
+// differs from what its name would imply.
+func (m *model) SaveVariable(key, value, oldKey string, secret bool) tea.Cmd {
+	env := m.environment
+	explicit := secret != m.secrets.IsSecret(m.environmentView(), key)
+	// Inherited and declared-only variables have no value of their own to remove when renamed
+	_, ownOldKey := m.selectedProject.InEnvironment(env).Variables[oldKey]
+	return m.mutateVariables(func(projectName string) error {
+		var err error
+		if explicit {
+			err = api.SetSecretVariable(m.apiHandler, projectName, env, key, value, secret)
+		} else {
+			err = api.SetVariableIn(m.apiHandler, projectName, env, key, value)
+		}
+		if err != nil {
+			return err
+		}
+		if ownOldKey && oldKey != key {
+			return api.UnsetVariableIn(m.apiHandler, projectName, env, oldKey)
+		}
+		return nil
+	})
+}
+
+func (m *model) deleteVariable(key string) tea.Cmd {
+	env := m.environment
+	return tea.Sequence(m.SetLoading(), m.mutateVariables(func(projectName string) error {
+		return api.UnsetVariableIn(m.apiHandler, projectName, env, key)
+	}))
+}
+
+// mutateVariables runs per-variable mutations and reloads the project so the table and CAS stay current.
+func (m *model) mutateVariables(mutate func(projectName string) error) tea.Cmd {
 	return func() tea.Msg {
-		_, err := m.apiHandler.UpdateProject(m.selectedProject.Name, *m.selectedProject)
+		projectName := m.selectedProject.Name
+		err := mutate(projectName)
+		var conflict *api.ConflictError
+		if errors.As(err, &conflict) {
+			latest, err := m.apiHandler.GetProject(projectName)
+			if err == nil {
+				return ProjectConflict{Latest: latest, Retry: m.mutateVariables(mutate), Back: VariablesList}
+			}
+			m.notice = fmt.Sprintf("%v, and the latest version could not be loaded: %v", conflict, err)
+		} else if err != nil {
+			m.notice = fmt.Sprintf("Failed to save: %v", err)
+		}
 		if err != nil {
-			panic(err)
+			m.state = VariablesList
+			return Message{}
 		}
+
+		project, err := m.apiHandler.GetProject(projectName)
+		if err != nil {
+			m.notice = fmt.Sprintf("Saved, but the project could not be reloaded: %v", err)
+			m.state = VariablesList
+			return Message{}
+		}
+		*m.selectedProject = project
+		m.projects[projectName] = project
+		if !project.HasEnvironment(m.environment) {
+			m.environment = mod.DefaultEnvironment
+		}
+
 		m.updateVariablesTable()
 		m.state = VariablesList
 		return Message{}
 	}
 }
 
-// Add this new function to handle variable deletion
-func (m *model) deleteVariable(key string) tea.Cmd {
-	return tea.Sequence(m.SetLoading(), func() tea.Msg {
-		delete(m.selectedProject.Variables, key)
-		return Message{}
-	}, m.SaveVariables())
+// #region ConflictCommands
+// saveChange applies change to the selected project and stores it. If the project was modified
+// by someone else since it was loaded, the latest version is fetched so the change can be merged.
+func (m *model) saveChange(change func(*mod.Project)) tea.Cmd {
+	return func() tea.Msg {
+		change(m.selectedProject)
+		project, err := m.apiHandler.UpdateProject(m.selectedProject.Name, *m.selectedProject)
+
+		var conflict *api.ConflictError
+		if errors.As(err, &conflict) {
+			latest, err := m.apiHandler.GetProject(m.selectedProject.Name)
+			if err != nil {
+				panic(err)
+			}
+			return ProjectConflict{Latest: latest, Retry: m.saveChange(change), Back: ProjectsList}
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		*m.selectedProject = project
+		m.projects[project.Name] = project
+		return GoToProjectsList{}
+	}
+}
+
+// showMergePrompt reloads the latest project and asks whether the pending change should be reapplied on top of it.
+func (m *model) showMergePrompt(conflict ProjectConflict) tea.Cmd {
+	*m.selectedProject = conflict.Latest
+	m.projects[conflict.Latest.Name] = conflict.Latest
+	m.updateProjectsTable()
+	if conflict.Back == VariablesList {
+		if !conflict.Latest.HasEnvironment(m.environment) {
+			m.environment = mod.DefaultEnvironment
+		}
+		m.updateVariablesTable()
+	}
+
+	return m.showConfirmForm(
+		tea.Sequence(m.SetLoading(), conflict.Retry),
+		conflict.Back,
+		"Project was changed by someone else",
+		"The latest version was reloaded. Merge your change into it?",
+	)
 }
 
 // #region Init
@@ -455,9 +899,27 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.updateProjectsTable()
 		m.customKeyMap.Configure.SetEnabled(true)
 		m.customKeyMap.Pull.SetEnabled(true)
+		m.customKeyMap.Create.SetEnabled(true)
+		m.customKeyMap.Edit.SetEnabled(true)
+		m.customKeyMap.Trash.SetEnabled(!m.offline())
+		m.customKeyMap.Restore.SetEnabled(false)
+		m.customKeyMap.Reveal.SetEnabled(false)
+		m.customKeyMap.RevealAll.SetEnabled(false)
+		m.customKeyMap.Environment.SetEnabled(false)
+		return m, nil
+	}
+
+	if hide, ok := msg.(HideRevealed); ok {
+		if hide.ID == m.revealID {
+			m.hideRevealed()
+		}
 		return m, nil
 	}
 
+	if conflict, ok := msg.(ProjectConflict); ok {
+		return m, m.showMergePrompt(conflict)
+	}
+
 	switch m.state {
 	case ProjectsList:
 		return m.updateProjectsList(msg)
@@ -471,6 +933,8 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.updateLoading(msg)
 	case Confirm:
 		return m.updateConfirmForm(msg)
+	case TrashList:
+		return m.updateTrashList(msg)
 	}
 
 	return m, nil
@@ -499,6 +963,8 @@ func (m *model) updateProjectsList(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		// Notices only describe the last action
+		m.notice = ""
 		switch {
 		case key.Matches(msg, m.customKeyMap.Quit):
 			return m, tea.Quit
@@ -532,7 +998,9 @@ func (m *model) updateProjectsList(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 			*m.selectedProject = m.projects[m.table.SelectedRow()[0]]
-			return m, m.showConfirmForm(tea.Sequence(m.SetLoading(), m.DeleteProject()), ProjectsList, "Are you sure you want to delete ", fmt.Sprintf("Project '%s'", m.selectedProject.Name))
+			return m, m.showConfirmForm(tea.Sequence(m.SetLoading(), m.DeleteProject()), ProjectsList, "Are you sure you want to delete ", fmt.Sprintf("Project '%s' will be moved to the trash", m.selectedProject.Name))
+		case key.Matches(msg, m.customKeyMap.Trash):
+			return m, m.showTrashTable()
 		}
 	}
 
@@ -561,15 +1029,26 @@ func (m *model) updateProjectForm(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.selectedProject.Name = m.form.GetString("Name")
 			m.selectedProject.TargetFolder = m.form.GetString("Folder")
 			m.selectedProject.FileName = m.form.GetString("File")
+			m.selectedProject.FileMode = strings.TrimSpace(m.form.GetString("Mode"))
 
 			return m, tea.Sequence(m.SetLoading(), m.CreateProject())
 		}
 
 		if m.state == EditProjectForm {
-			m.selectedProject.TargetFolder = m.form.GetString("Folder")
-			m.selectedProject.FileName = m.form.GetString("File")
+			name := strings.TrimSpace(m.form.GetString("Name"))
+			folder := m.form.GetString("Folder")
+			file := m.form.GetString("File")
+			mode := strings.TrimSpace(m.form.GetString("Mode"))
+			change := func(p *mod.Project) {
+				p.TargetFolder = folder
+				p.FileName = file
+				p.FileMode = mode
+			}
 
-			return m, tea.Sequence(m.SetLoading(), m.UpdateProject())
+			if name != m.selectedProject.Name {
+				return m, tea.Sequence(m.SetLoading(), m.RenameProject(name, change))
+			}
+			return m, tea.Sequence(m.SetLoading(), m.UpdateProject(change))
 		}
 		return m, tea.Batch(cmds...)
 	}
@@ -581,6 +1060,8 @@ func (m *model) updateProjectForm(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m *model) updateVariablesList(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		// Notices only describe the last action
+		m.notice = ""
 		switch {
 		case key.Matches(msg, m.customKeyMap.Quit):
 			m.customKeyMap.Configure.SetEnabled(true)
@@ -590,25 +1071,46 @@ func (m *model) updateVariablesList(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, m.customKeyMap.Create):
 			// Change this to show the new variable form
 			m.state = CreateVariableForm
-			m.form = createVariableForm("", "")
+			m.form = createVariableForm("", "", false, m.environmentView())
 			return m, m.form.Init()
 		case key.Matches(msg, m.customKeyMap.Edit):
 			// Like create, but set the form values
 			if len(m.varTable.Rows()) == 0 {
 				return m, nil
 			}
-			selectedRow := m.varTable.SelectedRow()
+			selectedKey := m.varTable.SelectedRow()[0]
 			m.state = EditVariableForm
-			m.oldKey = selectedRow[0]
-			m.form = createVariableForm(selectedRow[0], selectedRow[1])
+			m.oldKey = selectedKey
+			m.hideRevealed()
+			project := m.environmentView()
+			m.form = createVariableForm(selectedKey, project.Variables[selectedKey], m.secrets.IsSecret(project, selectedKey), project)
 			return m, m.form.Init()
 
+		case key.Matches(msg, m.customKeyMap.Reveal):
+			if len(m.varTable.Rows()) == 0 {
+				return m, nil
+			}
+			return m, m.revealSelected()
+
+		case key.Matches(msg, m.customKeyMap.RevealAll):
+			m.revealAll = !m.revealAll
+			m.renderVariableRows()
+			return m, nil
+
+		case key.Matches(msg, m.customKeyMap.Environment):
+			m.nextEnvironment()
+			return m, nil
+
 		case key.Matches(msg, m.customKeyMap.Delete):
 			if len(m.varTable.Rows()) == 0 {
 				return m, nil
 			}
 			// Delete the selected variable
 			selectedRow := m.varTable.SelectedRow()
+			if _, ok := m.selectedProject.InEnvironment(m.environment).Variables[selectedRow[0]]; !ok {
+				// Only declared by its metadata, or inherited, there is no value of its own to delete
+				return m, nil
+			}
 			return m, m.showConfirmForm(
 				m.deleteVariable(selectedRow[0]),
 				VariablesList,
@@ -619,6 +1121,47 @@ func (m *model) updateVariablesList(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 
 	m.varTable, _ = m.varTable.Update(msg)
+	if m.revealed != "" && (len(m.varTable.Rows()) == 0 || m.varTable.SelectedRow()[0] != m.revealed) {
+		m.hideRevealed()
+	}
+	return m, nil
+}
+
+// #region UpdateTrashList
+func (m *model) updateTrashList(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.customKeyMap.Quit):
+			return m, func() tea.Msg {
+				return GoToProjectsList{}
+			}
+		case key.Matches(msg, m.customKeyMap.Restore):
+			if len(m.trashTable.Rows()) == 0 {
+				return m, nil
+			}
+			projectName := m.trashTable.SelectedRow()[0]
+			return m, m.showConfirmForm(
+				tea.Sequence(m.SetLoading(), m.RestoreProject(projectName)),
+				TrashList,
+				"Restore project?",
+				fmt.Sprintf("Project '%s' will be moved back to the projects list", projectName),
+			)
+		case key.Matches(msg, m.customKeyMap.Delete):
+			if len(m.trashTable.Rows()) == 0 {
+				return m, nil
+			}
+			projectName := m.trashTable.SelectedRow()[0]
+			return m, m.showConfirmForm(
+				tea.Sequence(m.SetLoading(), m.PurgeProject(projectName)),
+				TrashList,
+				"Permanently delete project?",
+				fmt.Sprintf("Project '%s'. This action cannot be undone.", projectName),
+			)
+		}
+	}
+
+	m.trashTable, _ = m.trashTable.Update(msg)
 	return m, nil
 }
 
@@ -636,24 +1179,11 @@ func (m *model) updateVariableForm(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.form.GetBool("confirm") {
 			key := m.form.GetString("key")
 			value := m.form.GetString("value")
-			if m.selectedProject.Variables == nil {
-				m.selectedProject.Variables = make(map[string]string)
-			}
-
-			if m.state == CreateVariableForm {
-				m.selectedProject.Variables[key] = value
-			}
+			secret := m.form.GetBool("secret")
+			oldKey := m.oldKey
+			m.oldKey = ""
 
-			if m.state == EditVariableForm {
-				m.selectedProject.Variables[key] = value
-				if (m.oldKey != key){ 
-					delete(m.selectedProject.Variables, m.oldKey)
-				}
-				m.oldKey = ""
-			}
-
-			m.projects[m.selectedProject.Name] = *m.selectedProject
-			return m, tea.Sequence(m.SetLoading(), m.SaveVariables())
+			return m, tea.Sequence(m.SetLoading(), m.SaveVariable(key, value, oldKey, secret))
 		}
 		m.state = VariablesList
 		return m, nil
@@ -695,6 +1225,12 @@ func (m model) View() string {
 	switch m.state {
 	case ProjectsList:
 		s += baseStyle.Render(m.table.View()) + "\n"
+		if m.offline() {
+			s += lipgloss.NewStyle().Foreground(purple).Bold(true).Render("Offline: changes are queued until 'venom sync'.") + "\n"
+		}
+		if m.notice != "" {
+			s += lipgloss.NewStyle().Foreground(white).Bold(true).Render(m.notice) + "\n"
+		}
 		s += "\n" + m.table.Help.View(m.customKeyMap)
 		return s
 
@@ -710,7 +1246,34 @@ func (m model) View() string {
 		return s
 
 	case VariablesList:
+		if len(m.selectedProject.Environments) > 0 {
+			env := m.environment
+			if env == mod.DefaultEnvironment {
+				env = "default"
+			}
+			s += "\n" + lipgloss.NewStyle().Bold(true).Foreground(purple).Render("Environment: ")
+			s += lipgloss.NewStyle().Foreground(white).Bold(true).Render(env) + "\n"
+		}
+		if len(m.selectedProject.Parents) > 0 {
+			if len(m.selectedProject.Environments) == 0 {
+				s += "\n"
+			}
+			s += lipgloss.NewStyle().Bold(true).Foreground(purple).Render("Inherits from: ")
+			s += lipgloss.NewStyle().Foreground(white).Bold(true).Render(strings.Join(m.selectedProject.Parents, ", ")) + "\n"
+		}
 		s += baseStyle.Render(m.varTable.View()) + "\n"
+		if m.notice != "" {
+			s += lipgloss.NewStyle().Foreground(white).Bold(true).Render(m.notice) + "\n"
+		}
+		if _, _, err := m.inherited(); err != nil {
+			s += lipgloss.NewStyle().Foreground(purple).Bold(true).Render(fmt.Sprintf("%v. Showing only the project's own variables.", err)) + "\n"
+		}
+		if details := m.variableDetails(); details != "" {
+			s += details + "\n"
+		}
+		if m.revealAll {
+			s += lipgloss.NewStyle().Foreground(purple).Bold(true).Render("Secret values are visible. Press X to mask them.") + "\n"
+		}
 		s += "\n" + m.table.Help.View(m.customKeyMap)
 		return s
 	case CreateVariableForm:
@@ -729,36 +1292,71 @@ func (m model) View() string {
 	case Confirm:
 		s += baseStyle.Render(m.form.View()) + "\n"
 		return s
+
+	case TrashList:
+		s += "\n" + lipgloss.NewStyle().Bold(true).Foreground(purple).Render("Trash") + "\n"
+		s += baseStyle.Render(m.trashTable.View()) + "\n"
+		if m.notice != "" {
+			s += lipgloss.NewStyle().Foreground(white).Bold(true).Render(m.notice) + "\n"
+		}
+		s += "\n" + m.table.Help.View(m.customKeyMap)
+		return s
 	}
 
 	return ""
 }
 
 // #region Main
-func RunApp() {
+func RunApp(cfg config.Config) {
 
 	// Starts the TUI application
 	t := createProjectsTable()
 
 	v := createVariablesTable()
 
+	tt := createTrashTable()
+
 	spinner := spinner.New(
 		spinner.WithSpinner(spinner.Dot),
 		spinner.WithStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("57"))),
 	)
 	spinner.Tick()
 
-	fs := fs.New()
+	options, err := fs.OptionsFrom(cfg)
+	if err != nil {
+		fmt.Println("Error running program:", err)
+		os.Exit(1)
+	}
+	fs := fs.New(options)
 
-	m := model{Loading, t, v, "", customKeyMap, map[string]mod.Project{}, &mod.Project{}, nil, spinner, &api.ApiHandler{}, nil, ProjectsList, nil, fs}
+	secrets, err := secret.ParsePolicy(cfg.SecretPatterns)
+	if err != nil {
+		fmt.Println("Error running program:", err)
+		os.Exit(1)
+	}
+
+	m := model{
+		state:           Loading,
+		table:           t,
+		varTable:        v,
+		customKeyMap:    customKeyMap,
+		projects:        map[string]mod.Project{},
+		selectedProject: &mod.Project{},
+		spinner:         spinner,
+		config:          cfg,
+		previousState:   ProjectsList,
+		fs:              fs,
+		trashTable:      tt,
+		secrets:         secrets,
+	}
 
 	if _, err := tea.NewProgram(&m).Run(); err != nil {
 		fmt.Println("Error running program:", err)
 		os.Exit(1)
 	}
 
-	if m.cluster != nil {
-		m.cluster.Close(&gocb.ClusterCloseOptions{})
+	if m.apiHandler != nil {
+		m.apiHandler.Close()
 	}
 
 	println(lipgloss.NewStyle().Align(lipgloss.Center).
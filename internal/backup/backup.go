@@ -0,0 +1,251 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KaiqueGovani/venom/internal/api"
+	"github.com/KaiqueGovani/venom/internal/config"
+	"github.com/KaiqueGovani/venom/internal/model"
+)
+
+const (
+	// Format identifies venom backup archives.
+	Format = "venom-backup"
+	// Version is the archive layout written by this build. Older versions can always be read.
+	Version = 1
+)
+
+// Archive is a point-in-time copy of every project in a collection.
+type Archive struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by"`
+	Source    Source    `json:"source"`
+	Entries   []Entry   `json:"projects"`
+}
+
+// Source records where the projects were read from.
+type Source struct {
+	Profile    string `json:"profile,omitempty"`
+	Backend    string `json:"backend"`
+	Bucket     string `json:"bucket,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+	Collection string `json:"collection,omitempty"`
+}
+
+// Entry is a single project document with its metadata.
+type Entry struct {
+	ID      string        `json:"id"`
+	CAS     uint64        `json:"cas"`
+	Project model.Project `json:"project"`
+}
+
+// Create reads every project from the API into a new archive, ordered by document ID.
+func Create(a api.API, cfg config.Config) (Archive, error) {
+	projects, err := a.GetProjects()
+	if err != nil {
+		return Archive{}, err
+	}
+
+	archive := Archive{
+		Format:    Format,
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		CreatedBy: cfg.Author,
+		Source: Source{
+			Profile: cfg.Profile,
+			Backend: cfg.Backend,
+		},
+		Entries: make([]Entry, 0, len(projects)),
+	}
+	// Bucket, scope and collection only locate documents on Couchbase
+	if cfg.Backend == "couchbase" {
+		archive.Source.Bucket = cfg.Bucket
+		archive.Source.Scope = cfg.Scope
+		archive.Source.Collection = cfg.Collection
+	}
+
+	for id, project := range projects {
+		archive.Entries = append(archive.Entries, Entry{ID: id, CAS: project.CAS, Project: project})
+	}
+	sort.Slice(archive.Entries, func(i, j int) bool {
+		return archive.Entries[i].ID < archive.Entries[j].ID
+	})
+	return archive, nil
+}
+
+// WriteFile stores the archive as JSON, gzip-compressed when compress is set.
+// The file only holds the archive once it is complete.
+func WriteFile(path string, archive Archive, compress bool) (err error) {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	var w io.Writer = file
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(file)
+		w = zw
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(archive); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	if zw != nil {
+		if err = zw.Close(); err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// ReadFile loads an archive, detecting gzip compression from the file contents.
+func ReadFile(path string) (Archive, error) {
+	var archive Archive
+
+	file, err := os.Open(path)
+	if err != nil {
+		return archive, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer file.Close()
+
+	var r io.Reader = bufio.NewReader(file)
+	if magic, _ := r.(*bufio.Reader).Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return archive, fmt.Errorf("failed to decompress backup: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return archive, fmt.Errorf("failed to read backup: %w", err)
+	}
+	if archive.Format != Format {
+		return archive, fmt.Errorf("%s is not a venom backup", path)
+	}
+	if archive.Version < 1 || archive.Version > Version {
+		return archive, fmt.Errorf("backup version %d is not supported by this venom build (max %d)", archive.Version, Version)
+	}
+	return archive, nil
+}
+
+// Mode decides what happens to projects that already exist when restoring.
+type Mode string
+
+const (
+	SkipExisting Mode = "skip-existing"
+	Overwrite    Mode = "overwrite"
+)
+
+// ParseMode validates a restore mode given on the command line.
+func ParseMode(value string) (Mode, error) {
+	switch mode := Mode(value); mode {
+	case SkipExisting, Overwrite:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid restore mode %q, expected %s or %s", value, SkipExisting, Overwrite)
+}
+
+// Outcome of restoring a single entry.
+const (
+	Created     = "created"
+	Overwritten = "overwritten"
+	Skipped     = "skipped"
+	Failed      = "failed"
+)
+
+// Result describes what happened, or with dry run would happen, to one entry.
+type Result struct {
+	ID      string
+	Outcome string
+	Err     error
+}
+
+// Restore writes the archived projects through the API. With dryRun nothing is written, but
+// the results still report what each entry would do. Failures are reported per entry so a
+// single bad project does not stop the rest.
+func Restore(a api.API, archive Archive, mode Mode, dryRun bool) ([]Result, error) {
+	existing, err := a.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, 0, len(archive.Entries))
+	for _, entry := range archive.Entries {
+		result := Result{ID: entry.ID}
+		project, err := entryProject(entry)
+		if err != nil {
+			result.Outcome, result.Err = Failed, err
+			results = append(results, result)
+			continue
+		}
+
+		_, exists := existing[entry.ID]
+		switch {
+		case exists && mode == SkipExisting:
+			result.Outcome = Skipped
+		case exists:
+			result.Outcome = Overwritten
+			if !dryRun {
+				_, err = a.UpdateProject(entry.ID, project)
+			}
+		default:
+			result.Outcome = Created
+			if !dryRun {
+				_, err = a.CreateProject(project)
+			}
+		}
+		if errors.Is(err, api.ErrProjectExists) && mode == SkipExisting {
+			// Created by someone else since the listing
+			result.Outcome, err = Skipped, nil
+		}
+		if err != nil {
+			result.Outcome, result.Err = Failed, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// entryProject returns the project to store under the entry's document ID. Backends key
+// projects by name, so an ID that disagrees with the name cannot be preserved.
+func entryProject(entry Entry) (model.Project, error) {
+	project := entry.Project
+	// The archived CAS belongs to the source and must not be used as a write condition
+	project.CAS = 0
+	if strings.TrimSpace(entry.ID) == "" {
+		return project, errors.New("entry has no document ID")
+	}
+	if project.Name == "" {
+		project.Name = entry.ID
+	}
+	if project.Name != entry.ID {
+		return project, fmt.Errorf("document ID %s does not match project name %s", entry.ID, project.Name)
+	}
+	return project, nil
+}
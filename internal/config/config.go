@@ -0,0 +1,280 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Config holds the settings shared by the CLI, the TUI and the backends.
+type Config struct {
+	Profile    string
+	Backend    string
+	LocalPath  string
+	Bucket     string
+	Scope      string
+	Collection string
+
+	// HistoryCollection holds project revisions and TrashCollection deleted
+	// projects, both next to Collection.
+	HistoryCollection string
+	TrashCollection   string
+	// TrashRetention is how long deleted projects can be restored, as a Go duration.
+	TrashRetention string
+	// Author is recorded on every revision. Defaults to the OS user.
+	Author string
+	// OfflineCache keeps a local copy of remote projects for use while the
+	// server is unreachable, stored at CachePath or in the user cache directory.
+	OfflineCache string
+	CachePath    string
+	// Variable values are encrypted client-side with a master key read from
+	// EncryptionKeyFile or derived from the passphrase in EncryptionPassphraseEnv.
+	EncryptionKeyFile       string
+	EncryptionPassphraseEnv string
+	// SecretPatterns are the variable name patterns masked when a variable was
+	// never explicitly flagged as secret or not.
+	SecretPatterns string
+	// PullRoot is the folder env files are written under, the working directory when empty.
+	PullRoot string
+	// AllowSymlinks lets pull write env files through symlinks.
+	AllowSymlinks string
+
+	// Couchbase connection. Credentials may be given inline, read from the
+	// environment variable named by PasswordEnv, or loaded from EnvFile.
+	ConnectionString string
+	Username         string
+	Password         string
+	PasswordEnv      string
+	EnvFile          string
+	TLSSkipVerify    string
+	TLSCAFile        string
+	TLSCertFile      string
+	TLSKeyFile       string
+	WANDevelopment   string
+	ConnectTimeout   string
+	KVTimeout        string
+	QueryTimeout     string
+}
+
+func Default() Config {
+	return Config{
+		Backend:    "couchbase",
+		Bucket:     "venom",
+		Scope:      "mindsnap",
+		Collection: "projects",
+
+		HistoryCollection: "history",
+		TrashCollection:   "trash",
+		TrashRetention:    "720h",
+		Author:            currentUser(),
+		OfflineCache:      "true",
+		AllowSymlinks:     "false",
+		SecretPatterns:    "*SECRET*,*PASSWORD*,*PASSWD*,*TOKEN*,*CREDENTIAL*,*PRIVATE*,*_KEY,KEY,*APIKEY*",
+	}
+}
+
+// fields maps each config file key to the setting it controls. The matching
+// environment variable is the key in upper case prefixed with VENOM_.
+func (c *Config) fields() map[string]*string {
+	return map[string]*string{
+		"profile":                   &c.Profile,
+		"backend":                   &c.Backend,
+		"local_path":                &c.LocalPath,
+		"bucket":                    &c.Bucket,
+		"scope":                     &c.Scope,
+		"collection":                &c.Collection,
+		"history_collection":        &c.HistoryCollection,
+		"trash_collection":          &c.TrashCollection,
+		"trash_retention":           &c.TrashRetention,
+		"author":                    &c.Author,
+		"offline_cache":             &c.OfflineCache,
+		"cache_path":                &c.CachePath,
+		"encryption_key_file":       &c.EncryptionKeyFile,
+		"encryption_passphrase_env": &c.EncryptionPassphraseEnv,
+		"secret_patterns":           &c.SecretPatterns,
+		"pull_root":                 &c.PullRoot,
+		"allow_symlinks":            &c.AllowSymlinks,
+		"connection_string":         &c.ConnectionString,
+		"username":                  &c.Username,
+		"password":                  &c.Password,
+		"password_env":              &c.PasswordEnv,
+		"env_file":                  &c.EnvFile,
+		"tls_skip_verify":           &c.TLSSkipVerify,
+		"tls_ca_file":               &c.TLSCAFile,
+		"tls_cert_file":             &c.TLSCertFile,
+		"tls_key_file":              &c.TLSKeyFile,
+		"wan_development":           &c.WANDevelopment,
+		"connect_timeout":           &c.ConnectTimeout,
+		"kv_timeout":                &c.KVTimeout,
+		"query_timeout":             &c.QueryTimeout,
+	}
+}
+
+// Path returns the config file location, honoring VENOM_CONFIG.
+func Path() (string, error) {
+	if path := os.Getenv("VENOM_CONFIG"); path != "" {
+		return path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "venom", "config"), nil
+}
+
+// file is the parsed config file: top-level settings followed by named [profile] sections.
+type file struct {
+	base     Config
+	profiles map[string]Config
+}
+
+// Load resolves the configuration once. Later sources win: defaults, the top of the
+// config file, the selected profile section, VENOM_* environment variables and
+// finally the non-empty fields of overrides. The profile is chosen by
+// overrides.Profile, then VENOM_PROFILE, then the file's own "profile" key.
+func Load(overrides Config) (Config, error) {
+	cfg := Default()
+
+	path, err := Path()
+	if err != nil {
+		return cfg, err
+	}
+	f, err := readFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	env := fromEnv()
+	cfg.merge(f.base)
+
+	profile := firstNonEmpty(overrides.Profile, env.Profile, f.base.Profile)
+	if profile != "" {
+		section, ok := f.profiles[profile]
+		if !ok {
+			return cfg, fmt.Errorf("profile %q not found in %s", profile, path)
+		}
+		cfg.merge(section)
+	}
+
+	cfg.merge(env)
+	cfg.merge(overrides)
+	cfg.Profile = profile
+
+	return cfg, nil
+}
+
+// Profiles returns the names of the profiles defined in the config file.
+func Profiles() ([]string, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	f, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(f.profiles))
+	for name := range f.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// merge copies every non-empty field of other into c.
+func (c *Config) merge(other Config) {
+	fields := c.fields()
+	for key, value := range other.fields() {
+		if *value != "" {
+			*fields[key] = *value
+		}
+	}
+}
+
+func fromEnv() Config {
+	var cfg Config
+	for key, value := range cfg.fields() {
+		*value = os.Getenv("VENOM_" + strings.ToUpper(key))
+	}
+	return cfg
+}
+
+// readFile parses "key = value" lines and "[name]" profile headers, ignoring
+// blank lines and # comments. A missing file is not an error.
+func readFile(path string) (file, error) {
+	f := file{profiles: make(map[string]Config)}
+
+	osFile, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return f, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer osFile.Close()
+
+	current := &f.base
+	profile := ""
+	scanner := bufio.NewScanner(osFile)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if profile != "" {
+				f.profiles[profile] = *current
+			}
+			profile = strings.TrimSpace(line[1 : len(line)-1])
+			if profile == "" {
+				return f, fmt.Errorf("%s:%d: empty profile name", path, lineNumber)
+			}
+			if _, ok := f.profiles[profile]; ok {
+				return f, fmt.Errorf("%s:%d: profile %q defined twice", path, lineNumber, profile)
+			}
+			current = &Config{}
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return f, fmt.Errorf("%s:%d: expected key = value", path, lineNumber)
+		}
+		key = strings.TrimSpace(key)
+		field, ok := current.fields()[key]
+		if !ok || (profile != "" && key == "profile") {
+			return f, fmt.Errorf("%s:%d: unknown key %q", path, lineNumber, key)
+		}
+		*field = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	if err := scanner.Err(); err != nil {
+		return f, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if profile != "" {
+		f.profiles[profile] = *current
+	}
+
+	return f, nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return firstNonEmpty(os.Getenv("USER"), os.Getenv("USERNAME"), "unknown")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
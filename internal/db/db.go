@@ -1,44 +1,182 @@
 package db
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/KaiqueGovani/venom/internal/config"
 	"github.com/couchbase/gocb/v2"
 	"github.com/joho/godotenv"
 )
 
-func Connect() (*gocb.Cluster, error) {
-	// Update this to your cluster details
+const defaultReadyTimeout = 5 * time.Second
 
-	// Load .env file
-	err := godotenv.Load()
-	if err != nil {
+// Connect opens the configured cluster and waits until its bucket is ready,
+// so connection problems surface here rather than on the first operation.
+func Connect(cfg config.Config) (*gocb.Cluster, error) {
+	// Load credentials from the profile's env file, or from a .env in the
+	// current directory when there is one
+	if cfg.EnvFile != "" {
+		if err := godotenv.Load(cfg.EnvFile); err != nil {
+			return nil, fmt.Errorf("failed to load env file %s: %w", cfg.EnvFile, err)
+		}
+	} else if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
 
-	connectionString := os.Getenv("COUCHBASE_CONNECTION_STRING")
-	username := os.Getenv("COUCHBASE_USERNAME")
-	password := os.Getenv("COUCHBASE_PASSWORD")
-
-	options := gocb.ClusterOptions{
-		Authenticator: gocb.PasswordAuthenticator{
-			Username: username,
-			Password: password,
-		},
+	connectionString := firstNonEmpty(cfg.ConnectionString, os.Getenv("COUCHBASE_CONNECTION_STRING"))
+	if connectionString == "" {
+		return nil, errors.New("no Couchbase connection string configured")
+	}
+	// Bare hosts keep the historical TLS default; an explicit scheme such as
+	// couchbase:// is used as given
+	if !strings.Contains(connectionString, "://") {
+		connectionString = "couchbases://" + connectionString
 	}
 
-	// Sets a pre-configured profile called "wan-development" to help avoid latency issues
-	// when accessing Capella from a different Wide Area Network
-	// or Availability Zone (e.g. your laptop).
-	if err := options.ApplyProfile(gocb.ClusterConfigProfileWanDevelopment); err != nil {
+	options, err := clusterOptions(cfg)
+	if err != nil {
 		return nil, err
 	}
 
 	// Initialize the Connection
-	cluster, err := gocb.Connect("couchbases://"+connectionString, options)
+	cluster, err := gocb.Connect(connectionString, options)
 	if err != nil {
 		return nil, err
 	}
 
+	readyTimeout := defaultReadyTimeout
+	if options.TimeoutsConfig.ConnectTimeout > 0 {
+		readyTimeout = options.TimeoutsConfig.ConnectTimeout
+	}
+	if err := cluster.Bucket(cfg.Bucket).WaitUntilReady(readyTimeout, nil); err != nil {
+		cluster.Close(nil)
+		return nil, fmt.Errorf("bucket %q at %s was not ready after %s: %w", cfg.Bucket, connectionString, readyTimeout, err)
+	}
+
 	return cluster, nil
 }
+
+func clusterOptions(cfg config.Config) (gocb.ClusterOptions, error) {
+	var options gocb.ClusterOptions
+
+	wanDevelopment, err := parseBool("wan_development", cfg.WANDevelopment, true)
+	if err != nil {
+		return options, err
+	}
+	if wanDevelopment {
+		// Sets a pre-configured profile called "wan-development" to help avoid latency issues
+		// when accessing Capella from a different Wide Area Network
+		// or Availability Zone (e.g. your laptop).
+		if err := options.ApplyProfile(gocb.ClusterConfigProfileWanDevelopment); err != nil {
+			return options, err
+		}
+	}
+
+	// Explicit timeouts override the ones from the profile
+	timeouts := []struct {
+		key    string
+		value  string
+		target *time.Duration
+	}{
+		{"connect_timeout", cfg.ConnectTimeout, &options.TimeoutsConfig.ConnectTimeout},
+		{"kv_timeout", cfg.KVTimeout, &options.TimeoutsConfig.KVTimeout},
+		{"query_timeout", cfg.QueryTimeout, &options.TimeoutsConfig.QueryTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(timeout.value)
+		if err != nil {
+			return options, fmt.Errorf("invalid %s value %q: %w", timeout.key, timeout.value, err)
+		}
+		*timeout.target = duration
+	}
+
+	options.SecurityConfig.TLSSkipVerify, err = parseBool("tls_skip_verify", cfg.TLSSkipVerify, false)
+	if err != nil {
+		return options, err
+	}
+	if cfg.TLSCAFile != "" {
+		options.SecurityConfig.TLSRootCAs, err = loadCertPool(cfg.TLSCAFile)
+		if err != nil {
+			return options, err
+		}
+	}
+
+	options.Authenticator, err = authenticator(cfg)
+	if err != nil {
+		return options, err
+	}
+
+	return options, nil
+}
+
+// authenticator uses the client certificate when one is configured and falls back to username and password.
+func authenticator(cfg config.Config) (gocb.Authenticator, error) {
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			return nil, errors.New("tls_cert_file and tls_key_file must be set together")
+		}
+		certificate, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		return gocb.CertificateAuthenticator{ClientCertificate: &certificate}, nil
+	}
+
+	username := firstNonEmpty(cfg.Username, os.Getenv("COUCHBASE_USERNAME"))
+	password := cfg.Password
+	if cfg.PasswordEnv != "" {
+		password = os.Getenv(cfg.PasswordEnv)
+	}
+	password = firstNonEmpty(password, os.Getenv("COUCHBASE_PASSWORD"))
+
+	return gocb.PasswordAuthenticator{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+// loadCertPool reads one or more comma-separated PEM files into a certificate pool.
+func loadCertPool(files string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, file := range strings.Split(files, ",") {
+		file = strings.TrimSpace(file)
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA file %s", file)
+		}
+	}
+	return pool, nil
+}
+
+func parseBool(key, value string, fallback bool) (bool, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %q", key, value)
+	}
+	return parsed, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,232 @@
+// Package envelope encrypts variable values with a per-project data key that is itself
+// encrypted ("wrapped") by a master key kept on the client.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/KaiqueGovani/venom/internal/model"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// Version of the encryption format written by this package.
+	Version = 1
+
+	keySize     = 32
+	saltSize    = 16
+	valuePrefix = "enc:v1:"
+	// Iterations of PBKDF2-HMAC-SHA256 used to derive a master key from a passphrase.
+	passphraseIterations = 600_000
+)
+
+var (
+	ErrDecrypt = errors.New("wrong encryption key or corrupted data")
+	// ErrNotSealed is returned when a value of an encrypted project is stored in plaintext.
+	ErrNotSealed = errors.New("value is stored unencrypted")
+
+	// dataKeyLabel binds wrapped data keys so they cannot be swapped with sealed values.
+	dataKeyLabel = []byte("venom data key")
+)
+
+// MasterKey wraps and unwraps project data keys.
+type MasterKey struct {
+	key        []byte
+	passphrase []byte
+
+	mu sync.Mutex
+	// derived caches passphrase keys by salt, since each derivation is deliberately slow
+	derived map[string][]byte
+	// salt is reused for every data key wrapped by this master key
+	salt string
+}
+
+// LoadKeyFile reads a 32-byte master key, stored raw, hex-encoded or base64-encoded.
+func LoadKeyFile(path string) (*MasterKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+	}
+	if len(data) == keySize {
+		return &MasterKey{key: data}, nil
+	}
+
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == keySize {
+		return &MasterKey{key: key}, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == keySize {
+		return &MasterKey{key: key}, nil
+	}
+	return nil, fmt.Errorf("encryption key file %s must hold %d bytes, raw, hex or base64 encoded", path, keySize)
+}
+
+// FromPassphrase returns a master key derived from a passphrase.
+func FromPassphrase(passphrase string) (*MasterKey, error) {
+	if passphrase == "" {
+		return nil, errors.New("the encryption passphrase is empty")
+	}
+	return &MasterKey{passphrase: []byte(passphrase), derived: make(map[string][]byte)}, nil
+}
+
+// NewDataKey creates a random data key and returns it with its wrapped form.
+func (m *MasterKey) NewDataKey() ([]byte, model.Encryption, error) {
+	encryption := model.Encryption{Version: Version}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, encryption, err
+	}
+
+	var err error
+	if m.passphrase != nil {
+		encryption.Salt, err = m.currentSalt()
+		if err != nil {
+			return nil, encryption, err
+		}
+	}
+	wrappingKey, err := m.wrappingKey(encryption.Salt)
+	if err != nil {
+		return nil, encryption, err
+	}
+	encryption.WrappedKey, err = seal(wrappingKey, dataKey, dataKeyLabel)
+	return dataKey, encryption, err
+}
+
+// Unwrap returns the data key of an encrypted project.
+func (m *MasterKey) Unwrap(encryption model.Encryption) ([]byte, error) {
+	if encryption.Version != Version {
+		return nil, fmt.Errorf("unsupported encryption version %d", encryption.Version)
+	}
+	if (encryption.Salt != "") != (m.passphrase != nil) {
+		return nil, fmt.Errorf("%w: the project was encrypted with a key %s", ErrDecrypt, keySource(encryption))
+	}
+	wrappingKey, err := m.wrappingKey(encryption.Salt)
+	if err != nil {
+		return nil, err
+	}
+	return open(wrappingKey, encryption.WrappedKey, dataKeyLabel)
+}
+
+// wrappingKey returns the key file key, or the passphrase key derived with salt.
+func (m *MasterKey) wrappingKey(salt string) ([]byte, error) {
+	if m.passphrase == nil {
+		return m.key, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if key, ok := m.derived[salt]; ok {
+		return key, nil
+	}
+	rawSalt, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil || len(rawSalt) != saltSize {
+		return nil, fmt.Errorf("%w: invalid key salt", ErrDecrypt)
+	}
+	key := deriveKey(m.passphrase, rawSalt, passphraseIterations)
+	m.derived[salt] = key
+	if m.salt == "" {
+		m.salt = salt
+	}
+	return key, nil
+}
+
+// currentSalt returns the salt for new data keys, reusing one already derived when possible.
+func (m *MasterKey) currentSalt() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.salt == "" {
+		rawSalt := make([]byte, saltSize)
+		if _, err := rand.Read(rawSalt); err != nil {
+			return "", err
+		}
+		m.salt = base64.StdEncoding.EncodeToString(rawSalt)
+	}
+	return m.salt, nil
+}
+
+func keySource(encryption model.Encryption) string {
+	if encryption.Salt != "" {
+		return "derived from a passphrase"
+	}
+	return "file"
+}
+
+// Seal encrypts a variable value, binding it to its key so values cannot be swapped between variables.
+func Seal(dataKey []byte, key string, value string) (string, error) {
+	sealed, err := seal(dataKey, []byte(value), []byte(key))
+	if err != nil {
+		return "", err
+	}
+	return valuePrefix + sealed, nil
+}
+
+// Open decrypts a value produced by Seal. Plaintext values are refused, so a value written
+// around the encryption cannot pass for one the project owner sealed.
+func Open(dataKey []byte, key string, value string) (string, error) {
+	if !IsSealed(value) {
+		return "", ErrNotSealed
+	}
+	plaintext, err := open(dataKey, strings.TrimPrefix(value, valuePrefix), []byte(key))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed reports whether a stored value is encrypted.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, valuePrefix)
+}
+
+// seal encrypts with AES-256-GCM, returning base64 of the nonce followed by the ciphertext.
+func seal(key []byte, plaintext []byte, additionalData []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, additionalData)), nil
+}
+
+func open(key []byte, sealed string, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey derives a master key from a passphrase with PBKDF2-HMAC-SHA256.
+func deriveKey(passphrase []byte, salt []byte, iterations int) []byte {
+	return pbkdf2.Key(passphrase, salt, iterations, keySize, sha256.New)
+}
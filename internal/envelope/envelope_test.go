@@ -0,0 +1,134 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test vectors for PBKDF2-HMAC-SHA256 from RFC 7914, section 11, truncated to the key size.
+func TestPBKDF2KnownAnswers(t *testing.T) {
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(deriveKey([]byte(tt.password), []byte(tt.salt), tt.iterations))
+		if got != tt.want {
+			t.Errorf("deriveKey(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	dataKey := bytes.Repeat([]byte{7}, keySize)
+
+	for _, value := range []string{"", "secret", "multi\nline=value"} {
+		sealed, err := Seal(dataKey, "API_KEY", value)
+		if err != nil {
+			t.Fatalf("Seal(%q): %v", value, err)
+		}
+		if !IsSealed(sealed) {
+			t.Errorf("Seal(%q) = %q, missing the %s prefix", value, sealed, valuePrefix)
+		}
+		got, err := Open(dataKey, "API_KEY", sealed)
+		if err != nil || got != value {
+			t.Errorf("Open(Seal(%q)) = %q, %v", value, got, err)
+		}
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	dataKey := bytes.Repeat([]byte{7}, keySize)
+	otherKey := bytes.Repeat([]byte{8}, keySize)
+	sealed, err := Seal(dataKey, "API_KEY", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dataKey []byte
+		key     string
+		value   string
+		want    error
+	}{
+		{"wrong key", otherKey, "API_KEY", sealed, ErrDecrypt},
+		{"wrong label", dataKey, "OTHER_KEY", sealed, ErrDecrypt},
+		{"tampered", dataKey, "API_KEY", sealed[:len(sealed)-2] + "AA", ErrDecrypt},
+		{"truncated", dataKey, "API_KEY", valuePrefix + "AAAA", ErrDecrypt},
+		{"plaintext", dataKey, "API_KEY", "secret", ErrNotSealed},
+		{"empty plaintext", dataKey, "API_KEY", "", ErrNotSealed},
+	}
+	for _, tt := range tests {
+		if _, err := Open(tt.dataKey, tt.key, tt.value); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Open() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestKeyFileDataKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "venom.key")
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(bytes.Repeat([]byte{1}, keySize))+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	master, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataKey, encryption, err := master.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encryption.Salt != "" {
+		t.Errorf("key file data key has salt %q", encryption.Salt)
+	}
+	unwrapped, err := master.Unwrap(encryption)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("Unwrap() = %x, %v, want %x", unwrapped, err, dataKey)
+	}
+
+	other := &MasterKey{key: bytes.Repeat([]byte{2}, keySize)}
+	if _, err := other.Unwrap(encryption); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Unwrap() with another key error = %v, want %v", err, ErrDecrypt)
+	}
+	passphrase, _ := FromPassphrase("correct horse")
+	if _, err := passphrase.Unwrap(encryption); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Unwrap() with a passphrase error = %v, want %v", err, ErrDecrypt)
+	}
+}
+
+func TestPassphraseDataKey(t *testing.T) {
+	master, err := FromPassphrase("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, encryption, err := master.NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encryption.Salt == "" {
+		t.Fatal("passphrase data key has no salt")
+	}
+
+	// A fresh master key derives the wrapping key again from the stored salt.
+	again, _ := FromPassphrase("correct horse")
+	unwrapped, err := again.Unwrap(encryption)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("Unwrap() = %x, %v, want %x", unwrapped, err, dataKey)
+	}
+
+	wrong, _ := FromPassphrase("battery staple")
+	if _, err := wrong.Unwrap(encryption); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("Unwrap() with a wrong passphrase error = %v, want %v", err, ErrDecrypt)
+	}
+}
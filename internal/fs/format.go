@@ -0,0 +1,173 @@
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/KaiqueGovani/venom/internal/model"
+)
+
+// Formats are the env file formats a target can be written in, by name.
+var Formats = map[string]func(names []string, values map[string]string) ([]byte, error){
+	"dotenv": formatDotenv,
+	"export": formatExport,
+	"json":   formatJSON,
+}
+
+// shellFormats are the formats meant to be sourced by a shell, whose variable names must be
+// POSIX identifiers so they cannot smuggle in commands.
+var shellFormats = map[string]bool{"dotenv": true, "export": true}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// plainValue matches values a shell reads back unchanged without quotes.
+var plainValue = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]*$`)
+
+// ValidateName checks that a variable name can be written to a shell-sourced env file.
+func ValidateName(name string) error {
+	if !identifier.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q: use letters, digits and underscores, not starting with a digit", name)
+	}
+	return nil
+}
+
+// ValidateTarget checks the path, format and renames of an output target.
+func ValidateTarget(target model.Target) error {
+	if target.Path == "" || !filepath.IsLocal(target.Path) {
+		return fmt.Errorf("%w: target path %q", ErrOutsideRoot, target.Path)
+	}
+	if _, ok := Formats[formatName(target)]; !ok {
+		return fmt.Errorf("unknown format %q for target %s (use %s)", target.Format, target.Path, strings.Join(FormatNames(), ", "))
+	}
+	sources := make(map[string]string, len(target.Rename))
+	for from, to := range target.Rename {
+		if from == "" || to == "" {
+			return fmt.Errorf("target %s renames %q to %q; both names are required", target.Path, from, to)
+		}
+		if source, ok := sources[to]; ok {
+			return fmt.Errorf("target %s renames both %s and %s to %s", target.Path, source, from, to)
+		}
+		sources[to] = from
+	}
+	if shellFormats[formatName(target)] {
+		for _, key := range target.Keys {
+			if _, renamed := target.Rename[key]; !renamed {
+				if err := ValidateName(key); err != nil {
+					return fmt.Errorf("target %s: %w", target.Path, err)
+				}
+			}
+		}
+		for _, to := range target.Rename {
+			if err := ValidateName(to); err != nil {
+				return fmt.Errorf("target %s: %w", target.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// FormatNames returns the sorted names of the supported formats.
+func FormatNames() []string {
+	names := make([]string, 0, len(Formats))
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatName(target model.Target) string {
+	if target.Format == "" {
+		return "dotenv"
+	}
+	return target.Format
+}
+
+// render returns the content of a target file for the given variables, after picking its
+// keys and applying its renames.
+func render(target model.Target, variables map[string]string) ([]byte, error) {
+	keys := target.Keys
+	if len(keys) == 0 {
+		for key := range variables {
+			keys = append(keys, key)
+		}
+	}
+
+	values := make(map[string]string, len(keys))
+	sources := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, ok := variables[key]
+		if !ok {
+			fmt.Printf("Warning: Variable %s is not set and will be left out of %s\n", key, target.Path)
+			continue
+		}
+		name := key
+		if renamed, ok := target.Rename[key]; ok {
+			name = renamed
+		}
+		if source, ok := sources[name]; ok {
+			return nil, fmt.Errorf("target %s would write both %s and %s as %s", target.Path, source, key, name)
+		}
+		sources[name] = key
+		values[name] = value
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	content, err := Formats[formatName(target)](names, values)
+	if err != nil {
+		return nil, fmt.Errorf("target %s: %w", target.Path, err)
+	}
+	return content, nil
+}
+
+// formatDotenv writes KEY=value lines, refusing names a shell sourcing the file would run and
+// single-quoting values that are not plain, so they cannot run commands or add variables.
+func formatDotenv(names []string, values map[string]string) ([]byte, error) {
+	var b strings.Builder
+	for _, name := range names {
+		if err := ValidateName(name); err != nil {
+			return nil, err
+		}
+		value := values[name]
+		if !plainValue.MatchString(value) {
+			value = singleQuote(value)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", name, value)
+	}
+	return []byte(b.String()), nil
+}
+
+// formatExport writes a shell script of export statements with single-quoted values,
+// refusing names that are not shell identifiers.
+func formatExport(names []string, values map[string]string) ([]byte, error) {
+	var b strings.Builder
+	for _, name := range names {
+		if err := ValidateName(name); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "export %s=%s\n", name, singleQuote(values[name]))
+	}
+	return []byte(b.String()), nil
+}
+
+// singleQuote quotes a value for a shell, which reads everything between single quotes as is.
+func singleQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// formatJSON writes a JSON object of the variables.
+func formatJSON(names []string, values map[string]string) ([]byte, error) {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
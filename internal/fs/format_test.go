@@ -0,0 +1,84 @@
+package fs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormatDotenvQuotesValues(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "KEY=\n"},
+		{"postgres://db:5432/app", "KEY=postgres://db:5432/app\n"},
+		{"x$(touch pwned)", "KEY='x$(touch pwned)'\n"},
+		{"x\nFOO=bar", "KEY='x\nFOO=bar'\n"},
+		{"it's", "KEY='it'\\''s'\n"},
+	}
+	for _, tt := range tests {
+		got, err := formatDotenv([]string{"KEY"}, map[string]string{"KEY": tt.value})
+		if err != nil {
+			t.Fatalf("formatDotenv(%q): %v", tt.value, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("formatDotenv(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+// Sourcing a dotenv file must set exactly the values written, without running anything.
+func TestFormatDotenvSourced(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell to source the file with")
+	}
+
+	dir := t.TempDir()
+	values := map[string]string{
+		"CMD":     "x$(touch pwned)`touch pwned`",
+		"NEWLINE": "x\nFOO=bar",
+		"QUOTES":  `it's "quoted" \ $HOME`,
+	}
+	content, err := formatDotenv([]string{"CMD", "NEWLINE", "QUOTES"}, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, ".env")
+	if err := os.WriteFile(file, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range values {
+		cmd := exec.Command(sh, "-c", `. ./.env && printf %s "$`+name+`"`)
+		cmd.Dir = dir
+		cmd.Env = []string{}
+		got, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("sourcing for %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("sourced %s = %q, want %q", name, got, want)
+		}
+	}
+
+	cmd := exec.Command(sh, "-c", `. ./.env && printf %s "${FOO-unset}"`)
+	cmd.Dir = dir
+	cmd.Env = []string{}
+	if got, err := cmd.Output(); err != nil || string(got) != "unset" {
+		t.Errorf("sourcing set FOO = %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+		t.Error("sourcing the file ran a command")
+	}
+}
+
+func TestFormatDotenvRejectsNames(t *testing.T) {
+	for _, name := range []string{"A;touch x", "1ABC", "A-B", ""} {
+		if _, err := formatDotenv([]string{name}, map[string]string{name: "v"}); err == nil {
+			t.Errorf("formatDotenv accepted name %q", name)
+		}
+	}
+}
@@ -1,63 +1,326 @@
 package fs
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/KaiqueGovani/venom/internal/config"
 	"github.com/KaiqueGovani/venom/internal/model"
+	"github.com/KaiqueGovani/venom/internal/validation"
+)
+
+// DefaultFileMode is used for env files of projects without a file mode of their own.
+const DefaultFileMode os.FileMode = 0o600
+
+// dirMode is used for target folders that do not exist yet.
+const dirMode os.FileMode = 0o750
+
+var (
+	ErrSymlink     = errors.New("refusing to write through a symlink")
+	ErrOutsideRoot = errors.New("path escapes the pull root")
 )
 
 type FileSystem interface {
 	SaveVariables([]model.Project) error
 }
 
-type fs struct{}
+// Options control how env files are written.
+type Options struct {
+	// Root is the folder every env file is written under, the working directory when empty.
+	Root string
+	// AllowSymlinks writes to the file a symlink points to instead of refusing.
+	AllowSymlinks bool
+}
+
+// OptionsFrom reads the file system settings of a configuration.
+func OptionsFrom(cfg config.Config) (Options, error) {
+	allow, err := strconv.ParseBool(cfg.AllowSymlinks)
+	if err != nil {
+		return Options{}, fmt.Errorf("invalid allow_symlinks value %q", cfg.AllowSymlinks)
+	}
+	return Options{Root: cfg.PullRoot, AllowSymlinks: allow}, nil
+}
+
+type fs struct {
+	options Options
+}
+
+func New(options Options) FileSystem {
+	return &fs{options: options}
+}
+
+// ParseFileMode reads an octal permission such as "0640". An empty string is the default mode.
+func ParseFileMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return DefaultFileMode, nil
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0o777 {
+		return 0, fmt.Errorf("invalid file mode %q: use octal permissions such as 0600", mode)
+	}
+	return os.FileMode(perm), nil
+}
+
+// ValidateTargetFolder checks that a target folder is a relative path inside the pull root.
+// An empty folder is the root itself.
+func ValidateTargetFolder(folder string) error {
+	if folder != "" && !filepath.IsLocal(folder) {
+		return fmt.Errorf("%w: target folder %q", ErrOutsideRoot, folder)
+	}
+	return nil
+}
+
+// ValidateFileName checks that a file name is a relative path inside its target folder.
+func ValidateFileName(name string) error {
+	if name != "" && !filepath.IsLocal(name) {
+		return fmt.Errorf("%w: file name %q", ErrOutsideRoot, name)
+	}
+	return nil
+}
+
+// ValidatePaths checks the target folder and file name of a project.
+func ValidatePaths(project model.Project) error {
+	if err := ValidateTargetFolder(project.TargetFolder); err != nil {
+		return fmt.Errorf("project %s: %w", project.Name, err)
+	}
+	if err := ValidateFileName(project.FileName); err != nil {
+		return fmt.Errorf("project %s: %w", project.Name, err)
+	}
+	return nil
+}
 
-func New() FileSystem {
-	return &fs{}
+// output is an env file ready to be written.
+type output struct {
+	project string
+	path    string
+	mode    os.FileMode
+	content []byte
 }
 
+// SaveVariables writes every output of each project under the root: its own file and its
+// targets. Everything is checked and rendered before anything is written, so a project
+// pointing outside the root, or two outputs sharing a path, write nothing.
 func (f *fs) SaveVariables(projects []model.Project) error {
-	// Get the current working directory
-	basePath, err := os.Getwd()
+	basePath, err := f.root()
 	if err != nil {
-		return fmt.Errorf("failed to get current working directory: %w", err)
+		return err
 	}
 
+	var outputs []output
+	owners := make(map[string]string)
 	for _, project := range projects {
-		// Create directories if they don't exist
-		targetFolder := path.Join(basePath, project.TargetFolder)
-		if err := os.MkdirAll(targetFolder, os.ModePerm); err != nil {
-			return fmt.Errorf("failed to create directories: %w", err)
+		if err := ValidatePaths(project); err != nil {
+			return err
+		}
+		mode, err := ParseFileMode(project.FileMode)
+		if err != nil {
+			return fmt.Errorf("project %s: %w", project.Name, err)
 		}
+		values, missing := project.Resolve()
+		if len(missing) > 0 {
+			return fmt.Errorf("project %s is missing required variables: %s", project.Name, strings.Join(missing, ", "))
+		}
+		if problems := validation.Values(project, model.DefaultEnvironment, values); len(problems) > 0 {
+			return fmt.Errorf("project %s has invalid variables: %w", project.Name, validation.Join(problems))
+		}
+		targets := project.Outputs()
+		if len(targets) == 0 {
+			return fmt.Errorf("project %s has no file name or targets", project.Name)
+		}
+
+		for _, target := range targets {
+			if err := ValidateTarget(target); err != nil {
+				return fmt.Errorf("project %s: %w", project.Name, err)
+			}
+			path := filepath.Join(basePath, filepath.FromSlash(target.Path))
+			if owner, ok := owners[path]; ok && owner == project.Name {
+				return fmt.Errorf("project %s writes %s twice", project.Name, path)
+			} else if ok {
+				return fmt.Errorf("projects %s and %s both write %s", owner, project.Name, path)
+			}
+			owners[path] = project.Name
 
-		// Create the file path
-		filePath := filepath.Join(targetFolder, project.FileName)
+			content, err := render(target, values)
+			if err != nil {
+				return fmt.Errorf("project %s: %w", project.Name, err)
+			}
+			outputs = append(outputs, output{project: project.Name, path: path, mode: mode, content: content})
+		}
+	}
 
-		// Check if the file already exists
-		// TODO: Separate this logic so the user can be asked if it should continue
-		if _, err := os.Stat(filePath); err == nil {
-			fmt.Printf("Warning: File %s already exists and will be overridden\n", filePath)
+	for _, out := range outputs {
+		// Create directories if they don't exist, unless a symlink leads them out of the root
+		targetFolder := filepath.Dir(out.path)
+		if err := f.checkConfined(basePath, targetFolder); err != nil {
+			return fmt.Errorf("project %s: %w", out.project, err)
+		}
+		if err := os.MkdirAll(targetFolder, dirMode); err != nil {
+			return fmt.Errorf("failed to create directories: %w", err)
 		}
 
-		// Create or truncate the file
-		file, err := os.Create(filePath)
+		filePath, err := f.checkTarget(out.path, out.mode)
 		if err != nil {
-			return fmt.Errorf("failed to create file: %w", err)
+			return err
+		}
+		if err := writeFile(filePath, out.mode, out.content); err != nil {
+			return err
 		}
-		defer file.Close()
+	}
 
-		// Write variables to the file if they are not empty
-		if len(project.Variables) > 0 {
-			for key, value := range project.Variables {
-				if _, err := file.WriteString(fmt.Sprintf("%s=%s\n", key, value)); err != nil {
-					return fmt.Errorf("failed to write to file: %w", err)
-				}
-			}
+	return nil
+}
+
+// root returns the absolute pull root.
+func (f *fs) root() (string, error) {
+	if f.options.Root == "" {
+		basePath, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get current working directory: %w", err)
 		}
+		return basePath, nil
+	}
+	basePath, err := filepath.Abs(f.options.Root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve pull root: %w", err)
+	}
+	info, err := os.Stat(basePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open pull root: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("pull root %s is not a directory", basePath)
 	}
+	return basePath, nil
+}
 
+// checkConfined makes sure that folder, once symlinks in its existing part are resolved, is
+// still inside root. It always passes when symlinks are allowed.
+func (f *fs) checkConfined(root string, folder string) error {
+	if f.options.AllowSymlinks {
+		return nil
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve pull root: %w", err)
+	}
+	realFolder, err := resolveExisting(folder)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(realRoot, realFolder); err != nil || (rel != "." && !filepath.IsLocal(rel)) {
+		return fmt.Errorf("%w: %s resolves to %s through a symlink (set allow_symlinks to follow it)", ErrOutsideRoot, folder, realFolder)
+	}
 	return nil
 }
+
+// resolveExisting resolves the symlinks of the longest existing prefix of path.
+func resolveExisting(path string) (string, error) {
+	missing := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, missing), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, missing), nil
+		}
+		missing = filepath.Join(filepath.Base(path), missing)
+		path = parent
+	}
+}
+
+// checkTarget warns about an existing file that is about to be overwritten and returns the path
+// to write to, which is the symlink's destination when symlinks are allowed.
+func (f *fs) checkTarget(filePath string, mode os.FileMode) (string, error) {
+	info, err := os.Lstat(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return filePath, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect %s: %w", filePath, err)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		if !f.options.AllowSymlinks {
+			return "", fmt.Errorf("%w: %s (set allow_symlinks to follow it)", ErrSymlink, filePath)
+		}
+		resolved, err := resolveLink(filePath)
+		if err != nil {
+			return "", err
+		}
+		info, err = os.Lstat(resolved)
+		if errors.Is(err, os.ErrNotExist) {
+			// A dangling link: writing creates the file it points to
+			return resolved, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to inspect %s: %w", resolved, err)
+		}
+		filePath = resolved
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", filePath)
+	}
+
+	// TODO: Separate this logic so the user can be asked if it should continue
+	fmt.Printf("Warning: File %s already exists and will be overridden\n", filePath)
+	if loose := info.Mode().Perm() &^ mode; loose != 0 {
+		fmt.Printf("Warning: File %s has permissions %04o, looser than %04o; they will be restricted\n", filePath, info.Mode().Perm(), mode)
+	}
+	if uid, ok := fileOwner(info); ok && uid != os.Getuid() {
+		fmt.Printf("Warning: File %s is owned by another user (uid %d), who will be able to read the new variables\n", filePath, uid)
+	}
+	return filePath, nil
+}
+
+// resolveLink returns the path a symlink to an env file leads to, which must stay in the
+// folder of the link even when symlinks are allowed. The link may be dangling.
+func resolveLink(link string) (string, error) {
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve symlink: %w", err)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(link), target)
+	}
+	resolved, err := resolveExisting(target)
+	if err != nil {
+		return "", err
+	}
+	folder, err := resolveExisting(filepath.Dir(link))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(folder, resolved); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w: %s points to %s, outside its folder", ErrSymlink, link, resolved)
+	}
+	return resolved, nil
+}
+
+// writeFile replaces the content of the file and sets its permissions to mode. checkTarget
+// has already resolved any symlink, so a symlink put in its place since is not followed.
+func writeFile(filePath string, mode os.FileMode, content []byte) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|noFollow, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+
+	// Restrict the file before writing, since an existing file keeps its previous permissions
+	if err := file.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", filePath, err)
+	}
+
+	if _, err := file.Write(content); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return file.Close()
+}
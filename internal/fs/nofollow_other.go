@@ -0,0 +1,6 @@
+//go:build !unix
+
+package fs
+
+// noFollow is not supported on this platform.
+const noFollow = 0
@@ -0,0 +1,219 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/KaiqueGovani/venom/internal/api"
+	"github.com/KaiqueGovani/venom/internal/config"
+	"github.com/KaiqueGovani/venom/internal/model"
+)
+
+// Outcome of migrating a single project.
+const (
+	Copied      = "copied"
+	Overwritten = "overwritten"
+	Conflict    = "conflict"
+	Resumed     = "already migrated"
+	Failed      = "failed"
+)
+
+// Options controls a migration between two APIs.
+type Options struct {
+	// Match is a path.Match pattern on project IDs. Empty matches every project.
+	Match string
+	// Overwrite replaces projects that already exist on the target instead of reporting a conflict.
+	Overwrite bool
+	// Checkpoint is the file recording migrated projects so an interrupted run can resume.
+	Checkpoint string
+}
+
+// Result describes what happened to one project.
+type Result struct {
+	ID      string
+	Outcome string
+	Err     error
+}
+
+// checkpoint lists the projects already written to the target by earlier runs.
+type checkpoint struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Done []string `json:"done"`
+}
+
+// CheckpointPath returns the default checkpoint file for a pair of profiles, next to the config file.
+func CheckpointPath(from string, to string) (string, error) {
+	configPath, err := config.Path()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), fmt.Sprintf("migrate-%s-%s.json", from, to)), nil
+}
+
+// Run copies projects from source to target under their original IDs, one at a time in ID order.
+// Each migrated project is added to the checkpoint, so running again after a failure only
+// retries what is left. Conflicts are not checkpointed, letting a later run with Overwrite
+// pick them up. The checkpoint is removed once every project made it across.
+func Run(source api.API, target api.API, from string, to string, options Options) ([]Result, error) {
+	if options.Match != "" {
+		if _, err := path.Match(options.Match, ""); err != nil {
+			return nil, fmt.Errorf("invalid project pattern %q: %w", options.Match, err)
+		}
+	}
+
+	state, err := loadCheckpoint(options.Checkpoint, from, to)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[string]bool, len(state.Done))
+	for _, id := range state.Done {
+		done[id] = true
+	}
+
+	// Projects the source key cannot decrypt fail on their own, leaving the checkpoint in place
+	projects, err := source.GetProjects()
+	unreadable := &api.UnreadableError{}
+	if err != nil && !errors.As(err, &unreadable) {
+		return nil, fmt.Errorf("failed to read projects from %s: %w", from, err)
+	}
+	existing, err := target.GetProjects()
+	var unreadableTarget *api.UnreadableError
+	if errors.As(err, &unreadableTarget) {
+		// They still exist on the target, whatever their values
+		for id := range unreadableTarget.Projects {
+			existing[id] = model.Project{}
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read projects from %s: %w", to, err)
+	}
+
+	ids := make([]string, 0, len(projects)+len(unreadable.Projects))
+	for id := range projects {
+		ids = append(ids, id)
+	}
+	for id := range unreadable.Projects {
+		ids = append(ids, id)
+	}
+	ids = slices.DeleteFunc(ids, func(id string) bool {
+		matched, _ := path.Match(options.Match, id)
+		return options.Match != "" && !matched
+	})
+	sort.Strings(ids)
+
+	// Projects are read decrypted with the source key and sealed again with the target's, so
+	// an encrypted project would land in plaintext on a target without a key
+	encrypting := api.EncryptsWrites(target)
+	for _, id := range ids {
+		if projects[id].Encryption != nil && !encrypting && !done[id] {
+			return nil, fmt.Errorf("project %s is encrypted but profile %s has no encryption key; configure one so it stays encrypted", id, to)
+		}
+	}
+
+	results := make([]Result, 0, len(ids))
+	complete := true
+	for _, id := range ids {
+		result := Result{ID: id}
+		if done[id] {
+			result.Outcome = Resumed
+			results = append(results, result)
+			continue
+		}
+		if err, ok := unreadable.Projects[id]; ok {
+			result.Outcome, result.Err = Failed, err
+			complete = false
+			results = append(results, result)
+			continue
+		}
+
+		project := projects[id]
+		project.Name = id
+		// The source CAS means nothing to the target
+		project.CAS = 0
+		// Neither does the data key wrapped with the source's master key; the target wraps a new one
+		project.Encryption = nil
+
+		_, exists := existing[id]
+		switch {
+		case exists && !options.Overwrite:
+			result.Outcome = Conflict
+		case exists:
+			result.Outcome = Overwritten
+			_, err = target.UpdateProject(id, project)
+		default:
+			result.Outcome = Copied
+			_, err = target.CreateProject(project)
+			if errors.Is(err, api.ErrProjectExists) && !options.Overwrite {
+				// Created on the target since it was listed
+				result.Outcome, err = Conflict, nil
+			}
+		}
+
+		if err != nil {
+			result.Outcome, result.Err = Failed, err
+		}
+		if result.Outcome == Conflict || result.Outcome == Failed {
+			complete = false
+		} else {
+			state.Done = append(state.Done, id)
+			if err := saveCheckpoint(options.Checkpoint, state); err != nil {
+				return results, err
+			}
+		}
+		results = append(results, result)
+	}
+
+	if complete && options.Checkpoint != "" {
+		if err := os.Remove(options.Checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func loadCheckpoint(file string, from string, to string) (checkpoint, error) {
+	state := checkpoint{From: from, To: to}
+	if file == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to read checkpoint %s: %w", file, err)
+	}
+	if state.From != from || state.To != to {
+		return state, fmt.Errorf("checkpoint %s belongs to a migration from %s to %s", file, state.From, state.To)
+	}
+	return state, nil
+}
+
+// saveCheckpoint replaces the checkpoint file in one step so a crash never leaves it half written.
+func saveCheckpoint(file string, state checkpoint) error {
+	if file == "" {
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return os.Rename(tmp, file)
+}
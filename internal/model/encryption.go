@@ -0,0 +1,10 @@
+package model
+
+// Encryption describes how a project's variable values are encrypted. The data key that
+// seals the values is stored wrapped by the master key, which never leaves the client.
+type Encryption struct {
+	Version    int    `json:"version"`
+	WrappedKey string `json:"wrapped_key"`
+	// Salt is set when the master key is derived from a passphrase.
+	Salt string `json:"salt,omitempty"`
+}
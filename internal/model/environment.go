@@ -0,0 +1,155 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// DefaultEnvironment names the project's own variables, used when no environment is given.
+const DefaultEnvironment = ""
+
+var environmentName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Environment is a named variant of a project, such as "staging" or "prod", with its own
+// variables. An empty FileName or TargetFolder falls back to the project's.
+type Environment struct {
+	Variables    map[string]string       `json:"variables"`
+	Meta         map[string]VariableMeta `json:"meta,omitempty"`
+	FileName     string                  `json:"file_name,omitempty"`
+	TargetFolder string                  `json:"target_folder,omitempty"`
+}
+
+// ValidateEnvironmentName checks that a name can be used for a new environment.
+func ValidateEnvironmentName(name string) error {
+	if !environmentName.MatchString(name) {
+		return fmt.Errorf("invalid environment name %q: use letters, digits, '.', '-' and '_'", name)
+	}
+	return nil
+}
+
+// HasEnvironment reports whether the project has the environment. The default one always exists.
+func (p Project) HasEnvironment(name string) bool {
+	if name == DefaultEnvironment {
+		return true
+	}
+	_, ok := p.Environments[name]
+	return ok
+}
+
+// EnvironmentNames returns the sorted names of the project's named environments.
+func (p Project) EnvironmentNames() []string {
+	names := make([]string, 0, len(p.Environments))
+	for name := range p.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InEnvironment returns the project as seen from an environment: its variables, metadata and
+// file overrides replace the project's. The result shares maps with p and must not be modified.
+func (p Project) InEnvironment(name string) Project {
+	env, ok := p.Environments[name]
+	if name == DefaultEnvironment || !ok {
+		return p
+	}
+	p.Variables = env.Variables
+	p.Meta = env.Meta
+	if env.FileName != "" {
+		p.FileName = env.FileName
+	}
+	if env.TargetFolder != "" {
+		p.TargetFolder = env.TargetFolder
+	}
+	return p
+}
+
+// SetVariableIn sets a variable in an environment, creating a missing named environment.
+func (p *Project) SetVariableIn(name string, key string, value string) {
+	p.editEnvironment(name, func(env *Environment) {
+		env.Variables[key] = value
+	})
+}
+
+// UnsetVariableIn removes a variable from an environment and reports whether it was set.
+func (p *Project) UnsetVariableIn(name string, key string) bool {
+	if !p.HasEnvironment(name) {
+		return false
+	}
+	if _, ok := p.InEnvironment(name).Variables[key]; !ok {
+		return false
+	}
+	p.editEnvironment(name, func(env *Environment) {
+		delete(env.Variables, key)
+	})
+	return true
+}
+
+// SetSecretIn flags a variable of an environment as secret or not. The flag is kept with the
+// name, so a variable that is removed and set again keeps it.
+func (p *Project) SetSecretIn(name string, key string, secret bool) {
+	p.EditMetaIn(name, key, func(meta *VariableMeta) {
+		meta.Secret = &secret
+	})
+}
+
+// TouchIn records that a variable of an environment was modified at the given time.
+func (p *Project) TouchIn(name string, key string, at time.Time) {
+	at = at.UTC()
+	p.EditMetaIn(name, key, func(meta *VariableMeta) {
+		meta.Modified = &at
+	})
+}
+
+// EditMetaIn applies edit to the metadata of a variable of an environment.
+func (p *Project) EditMetaIn(name string, key string, edit func(meta *VariableMeta)) {
+	p.editEnvironment(name, func(env *Environment) {
+		meta := env.Meta[key]
+		edit(&meta)
+		env.Meta[key] = meta
+	})
+}
+
+// SetFileIn overrides where the env file of a named environment is written, or sets the
+// project's own file and folder for the default environment.
+func (p *Project) SetFileIn(name string, fileName string, targetFolder string) {
+	if name == DefaultEnvironment {
+		p.FileName = fileName
+		p.TargetFolder = targetFolder
+		return
+	}
+	p.editEnvironment(name, func(env *Environment) {
+		env.FileName = fileName
+		env.TargetFolder = targetFolder
+	})
+}
+
+// editEnvironment applies edit to an environment whose maps are ready to be written.
+func (p *Project) editEnvironment(name string, edit func(env *Environment)) {
+	if name == DefaultEnvironment {
+		env := Environment{Variables: p.Variables, Meta: p.Meta}
+		ensureMaps(&env)
+		edit(&env)
+		p.Variables, p.Meta = env.Variables, env.Meta
+		return
+	}
+
+	if p.Environments == nil {
+		p.Environments = make(map[string]Environment)
+	}
+	env := p.Environments[name]
+	ensureMaps(&env)
+	edit(&env)
+	p.Environments[name] = env
+}
+
+func ensureMaps(env *Environment) {
+	if env.Variables == nil {
+		env.Variables = make(map[string]string)
+	}
+	if env.Meta == nil {
+		env.Meta = make(map[string]VariableMeta)
+	}
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInheritanceCycle = errors.New("projects inherit from each other")
+
+// Inheritance tells where the values of a resolved project come from.
+type Inheritance struct {
+	// From maps variables the project does not set itself to the parent their value comes from.
+	From map[string]string
+	// Overrides maps variables the project sets itself to the parent whose value they replace.
+	Overrides map[string]string
+}
+
+// Inherited returns the view of an environment of the project with the variables, metadata
+// and rules of its parents merged in. Parents are applied in order, so later ones win over
+// earlier ones and the project wins over them all; a parent without the environment
+// contributes its own variables. lookup reads parents by name. The view has no environments
+// of its own, since they are already resolved. If a parent cannot be read, or projects inherit
+// from each other, the error comes with the view of the project's own values.
+func (p Project) Inherited(env string, lookup func(name string) (Project, error)) (Project, Inheritance, error) {
+	return p.inherited(env, lookup, []string{p.Name})
+}
+
+func (p Project) inherited(env string, lookup func(name string) (Project, error), chain []string) (Project, Inheritance, error) {
+	view := p.InEnvironment(env)
+	view.Environments = nil
+	inheritance := Inheritance{From: map[string]string{}, Overrides: map[string]string{}}
+	if len(p.Parents) == 0 {
+		return view, inheritance, nil
+	}
+
+	variables := make(map[string]string)
+	meta := make(map[string]VariableMeta)
+	schema := make(map[string]Rule)
+	for _, name := range p.Parents {
+		path := append(slices.Clone(chain), name)
+		if slices.Contains(chain, name) {
+			return view, inheritance, fmt.Errorf("%w: %s", ErrInheritanceCycle, strings.Join(path, " → "))
+		}
+		parent, err := lookup(name)
+		if err != nil {
+			return view, inheritance, fmt.Errorf("parent of %s: %w", p.Name, err)
+		}
+		resolved, parentInheritance, err := parent.inherited(env, lookup, path)
+		if err != nil {
+			return view, inheritance, err
+		}
+
+		for key, value := range resolved.Variables {
+			variables[key] = value
+			// Values a parent inherits itself are credited to the project that sets them
+			if from, ok := parentInheritance.From[key]; ok {
+				inheritance.From[key] = from
+			} else {
+				inheritance.From[key] = name
+			}
+		}
+		for key, parentMeta := range resolved.Meta {
+			meta[key] = parentMeta.over(meta[key])
+		}
+		for key, rule := range resolved.Schema {
+			schema[key] = rule
+		}
+	}
+
+	for key, value := range view.Variables {
+		if from, ok := inheritance.From[key]; ok {
+			inheritance.Overrides[key] = from
+			delete(inheritance.From, key)
+		}
+		variables[key] = value
+	}
+	for key, ownMeta := range view.Meta {
+		meta[key] = ownMeta.over(meta[key])
+	}
+	for key, rule := range view.Schema {
+		schema[key] = rule
+	}
+	view.Variables, view.Meta, view.Schema = variables, meta, schema
+	return view, inheritance, nil
+}
+
+// over returns the metadata with the fields it leaves empty taken from base. A variable
+// required anywhere stays required.
+func (m VariableMeta) over(base VariableMeta) VariableMeta {
+	if m.Secret == nil {
+		m.Secret = base.Secret
+	}
+	if m.Description == "" {
+		m.Description = base.Description
+	}
+	if m.Owner == "" {
+		m.Owner = base.Owner
+	}
+	if m.Default == "" {
+		m.Default = base.Default
+	}
+	if m.Modified == nil {
+		m.Modified = base.Modified
+	}
+	m.Required = m.Required || base.Required
+	return m
+}
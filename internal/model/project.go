@@ -1,8 +1,30 @@
 package model
 
+// CurrentSchemaVersion is the layout of project documents written by this build.
+const CurrentSchemaVersion = 2
+
 type Project struct {
-	Name         string            `json:"name"`
-	FileName     string            `json:"file_name"`
-	TargetFolder string            `json:"target_folder"`
-	Variables    map[string]string `json:"variables"`
+	Name         string `json:"name"`
+	FileName     string `json:"file_name"`
+	TargetFolder string `json:"target_folder"`
+	// FileMode is the octal permission of the written env file, 0600 when empty.
+	FileMode string `json:"file_mode,omitempty"`
+	// Parents are projects whose variables this one inherits, later ones overriding earlier ones.
+	Parents []string `json:"parents,omitempty"`
+	// Targets are extra env files written on pull, each with its own path and format.
+	Targets   []Target          `json:"targets,omitempty"`
+	Variables map[string]string `json:"variables"`
+	// Meta holds per-variable settings, keyed like Variables.
+	Meta map[string]VariableMeta `json:"meta,omitempty"`
+	// Schema holds validation rules for variables, keyed like Variables.
+	Schema map[string]Rule `json:"schema,omitempty"`
+	// Environments are named variants of the project, each with its own variables.
+	Environments  map[string]Environment `json:"environments,omitempty"`
+	SchemaVersion int                    `json:"schema_version"`
+	// Encryption is set once the variable values are encrypted client-side.
+	Encryption *Encryption `json:"encryption,omitempty"`
+
+	// CAS is the backend version of the document when it was read. It is not stored in
+	// the document itself; a zero value skips the concurrency check on update.
+	CAS uint64 `json:"-"`
 }
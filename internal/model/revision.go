@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionRollback = "rollback"
+	ActionRestore  = "restore"
+	ActionRename   = "rename"
+)
+
+// Revision is an immutable record of a change to a project. Snapshot holds the
+// project as it was after the change; for deletions it is the last state before removal.
+type Revision struct {
+	Number    int       `json:"number"`
+	Project   string    `json:"project"`
+	Action    string    `json:"action"`
+	Detail    string    `json:"detail,omitempty"`
+	Author    string    `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+	Snapshot  Project   `json:"snapshot"`
+}
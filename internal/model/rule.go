@@ -0,0 +1,14 @@
+package model
+
+// Rule constrains the values of a variable, in every environment of a project.
+type Rule struct {
+	// Type is one of string, int, bool, url, enum and regex.
+	Type string `json:"type"`
+	// Min and Max bound an int, or the length of a string.
+	Min *int64 `json:"min,omitempty"`
+	Max *int64 `json:"max,omitempty"`
+	// Values lists the accepted values of an enum.
+	Values []string `json:"values,omitempty"`
+	// Pattern is the regular expression a regex value must match in full.
+	Pattern string `json:"pattern,omitempty"`
+}
@@ -0,0 +1,31 @@
+package model
+
+// Target is an extra env file written by pull, next to the project's own FileName in
+// TargetFolder.
+type Target struct {
+	// Path is relative to the pull root, such as "worker/.env".
+	Path string `json:"path"`
+	// Format is "dotenv" when empty. See fs.Formats for the others.
+	Format string `json:"format,omitempty"`
+	// Keys limits the file to these variables. Empty writes them all.
+	Keys []string `json:"keys,omitempty"`
+	// Rename maps variable names to the names written to the file.
+	Rename map[string]string `json:"rename,omitempty"`
+}
+
+// Outputs returns every file pull writes for the project: its own file when it has a file
+// name, followed by its targets.
+func (p Project) Outputs() []Target {
+	var outputs []Target
+	if p.FileName != "" {
+		outputs = append(outputs, Target{Path: joinPath(p.TargetFolder, p.FileName)})
+	}
+	return append(outputs, p.Targets...)
+}
+
+func joinPath(folder string, file string) string {
+	if folder == "" {
+		return file
+	}
+	return folder + "/" + file
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// TrashedProject is a deleted project kept for restoring until ExpiresAt.
+// A zero ExpiresAt means it is kept until purged.
+type TrashedProject struct {
+	Project   Project   `json:"project"`
+	DeletedBy string    `json:"deleted_by"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the retention period of the trashed project is over.
+func (t TrashedProject) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt)
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+// VariableMeta describes a single variable. Metadata may exist for a variable that is not
+// set, to document it or give it a default.
+type VariableMeta struct {
+	// Secret is nil for variables that were never flagged, whose masking is then
+	// decided by name.
+	Secret      *bool  `json:"secret,omitempty"`
+	Description string `json:"description,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	// Default is written on pull when the variable is not set.
+	Default string `json:"default,omitempty"`
+	// Required variables must be set, or have a default, to pull the project.
+	Required bool `json:"required,omitempty"`
+	// Modified is when the value was last set or removed.
+	Modified *time.Time `json:"modified,omitempty"`
+}
+
+// Declares reports whether the metadata describes the variable even while it is not set.
+func (m VariableMeta) Declares() bool {
+	return m.Description != "" || m.Owner != "" || m.Default != "" || m.Required
+}
+
+// SecretFlag returns the secret flag of a variable and whether it was ever set.
+func (p Project) SecretFlag(key string) (secret bool, flagged bool) {
+	meta, ok := p.Meta[key]
+	if !ok || meta.Secret == nil {
+		return false, false
+	}
+	return *meta.Secret, true
+}
+
+// VariableNames returns the sorted names of the variables that are set or declared by
+// their metadata.
+func (p Project) VariableNames() []string {
+	names := make([]string, 0, len(p.Variables))
+	for key := range p.Variables {
+		names = append(names, key)
+	}
+	for key, meta := range p.Meta {
+		if _, ok := p.Variables[key]; !ok && meta.Declares() {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the values written on pull, with defaults filled in for variables that
+// are not set, and the sorted names of required variables that have no value at all.
+func (p Project) Resolve() (map[string]string, []string) {
+	values := make(map[string]string, len(p.Variables))
+	for key, value := range p.Variables {
+		values[key] = value
+	}
+
+	var missing []string
+	for key, meta := range p.Meta {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if meta.Default != "" {
+			values[key] = meta.Default
+		} else if meta.Required {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return values, missing
+}
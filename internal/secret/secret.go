@@ -0,0 +1,66 @@
+// Package secret decides which variable values are sensitive and must be masked.
+package secret
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/KaiqueGovani/venom/internal/model"
+)
+
+// Placeholder is shown instead of a masked value.
+const Placeholder = "*****"
+
+// Policy treats flagged variables as their flag says, and unflagged ones as secret when
+// their name matches one of its patterns.
+type Policy struct {
+	patterns []string
+}
+
+// ParsePolicy reads a comma-separated list of shell patterns such as "*_TOKEN", matched
+// against variable names regardless of case. "none" turns name matching off.
+func ParsePolicy(patterns string) (Policy, error) {
+	var policy Policy
+	if strings.EqualFold(strings.TrimSpace(patterns), "none") {
+		return policy, nil
+	}
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.ToUpper(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return policy, fmt.Errorf("invalid secret pattern %q: %w", pattern, err)
+		}
+		policy.patterns = append(policy.patterns, pattern)
+	}
+	return policy, nil
+}
+
+// IsSecret reports whether the value of a project variable must be masked.
+func (p Policy) IsSecret(project model.Project, key string) bool {
+	if secret, flagged := project.SecretFlag(key); flagged {
+		return secret
+	}
+	return p.Matches(key)
+}
+
+// Matches reports whether a variable name looks sensitive.
+func (p Policy) Matches(key string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range p.patterns {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Mask returns the value to display for a project variable.
+func (p Policy) Mask(project model.Project, key string, value string) string {
+	if p.IsSecret(project, key) {
+		return Placeholder
+	}
+	return value
+}
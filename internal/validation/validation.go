@@ -0,0 +1,187 @@
+// Package validation checks variable values against the rules of a project's schema.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KaiqueGovani/venom/internal/model"
+)
+
+// Types are the supported rule types.
+var Types = []string{"string", "int", "bool", "url", "enum", "regex"}
+
+var (
+	ErrInvalid  = errors.New("invalid value")
+	ErrRequired = errors.New("required but not set")
+)
+
+// Problem is a variable of a project that does not satisfy the schema.
+type Problem struct {
+	Environment string
+	Key         string
+	Err         error
+}
+
+func (p Problem) Error() string {
+	if p.Environment == model.DefaultEnvironment {
+		return fmt.Sprintf("%s: %v", p.Key, p.Err)
+	}
+	return fmt.Sprintf("%s (environment %s): %v", p.Key, p.Environment, p.Err)
+}
+
+// CheckRule reports whether a rule is well formed.
+func CheckRule(rule model.Rule) error {
+	switch rule.Type {
+	case "string", "int":
+	case "bool", "url":
+		if rule.Min != nil || rule.Max != nil {
+			return fmt.Errorf("min and max do not apply to %s rules", rule.Type)
+		}
+	case "enum":
+		if len(rule.Values) == 0 {
+			return errors.New("enum rules need at least one value")
+		}
+	case "regex":
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown rule type %q (use %s)", rule.Type, strings.Join(Types, ", "))
+	}
+	if rule.Min != nil && rule.Max != nil && *rule.Min > *rule.Max {
+		return fmt.Errorf("min %d is greater than max %d", *rule.Min, *rule.Max)
+	}
+	return nil
+}
+
+// Describe summarizes a rule for listings.
+func Describe(rule model.Rule) string {
+	description := rule.Type
+	if rule.Min != nil {
+		description += fmt.Sprintf(", min %d", *rule.Min)
+	}
+	if rule.Max != nil {
+		description += fmt.Sprintf(", max %d", *rule.Max)
+	}
+	if len(rule.Values) > 0 {
+		description += ", one of " + strings.Join(rule.Values, ", ")
+	}
+	if rule.Pattern != "" {
+		description += ", matching " + rule.Pattern
+	}
+	return description
+}
+
+// Value checks a value against a rule. Errors never include the value, which may be secret.
+func Value(rule model.Rule, value string) error {
+	switch rule.Type {
+	case "string":
+		return checkRange(rule, int64(len([]rune(value))), "length")
+	case "int":
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: must be an integer", ErrInvalid)
+		}
+		return checkRange(rule, number, "value")
+	case "bool":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%w: must be true or false", ErrInvalid)
+		}
+	case "url":
+		parsed, err := url.Parse(value)
+		// Without a host, host:port values such as localhost:5432 would parse as a scheme
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("%w: must be an absolute URL such as https://example.com", ErrInvalid)
+		}
+	case "enum":
+		if !slices.Contains(rule.Values, value) {
+			return fmt.Errorf("%w: must be one of %s", ErrInvalid, strings.Join(rule.Values, ", "))
+		}
+	case "regex":
+		pattern, err := compile(rule.Pattern)
+		if err != nil {
+			return err
+		}
+		if !pattern.MatchString(value) {
+			return fmt.Errorf("%w: must match %s", ErrInvalid, rule.Pattern)
+		}
+	}
+	return nil
+}
+
+// Variable checks a value against the rule the project's schema has for key, if any.
+func Variable(project model.Project, key string, value string) error {
+	rule, ok := project.Schema[key]
+	if !ok {
+		return nil
+	}
+	return Value(rule, value)
+}
+
+// Project checks every environment of a project with Environment.
+func Project(project model.Project) []Problem {
+	problems := Environment(project, model.DefaultEnvironment)
+	for _, env := range project.EnvironmentNames() {
+		problems = append(problems, Environment(project, env)...)
+	}
+	return problems
+}
+
+// Environment checks the values pull would write for an environment, defaults included:
+// they must satisfy the schema, and required variables must have a value.
+func Environment(project model.Project, env string) []Problem {
+	values, missing := project.InEnvironment(env).Resolve()
+	var problems []Problem
+	for _, key := range missing {
+		problems = append(problems, Problem{Environment: env, Key: key, Err: ErrRequired})
+	}
+	return append(problems, Values(project, env, values)...)
+}
+
+// Values checks resolved values of an environment against the project's schema, by key order.
+func Values(project model.Project, env string, values map[string]string) []Problem {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []Problem
+	for _, key := range keys {
+		if err := Variable(project, key, values[key]); err != nil {
+			problems = append(problems, Problem{Environment: env, Key: key, Err: err})
+		}
+	}
+	return problems
+}
+
+// Join reports problems as one error, one problem per line, or nil if there are none.
+func Join(problems []Problem) error {
+	errs := make([]error, len(problems))
+	for i, problem := range problems {
+		errs[i] = problem
+	}
+	return errors.Join(errs...)
+}
+
+func checkRange(rule model.Rule, number int64, what string) error {
+	if rule.Min != nil && number < *rule.Min {
+		return fmt.Errorf("%w: %s must be at least %d", ErrInvalid, what, *rule.Min)
+	}
+	if rule.Max != nil && number > *rule.Max {
+		return fmt.Errorf("%w: %s must be at most %d", ErrInvalid, what, *rule.Max)
+	}
+	return nil
+}
+
+// compile anchors a pattern so it must match the whole value.
+func compile(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}